@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+)
+
+// loadConfig reads the JSON config file named by the config flag, if any. Each
+// key in the file is the long name of a command line flag, and its value is
+// used if that flag was not set on the command line or in the environment.
+// Array values are used for flags that can be given more than once.
+func loadConfig(c *cli.Context) error {
+	file := c.String("config")
+
+	if file == "" {
+		return nil
+	}
+
+	buf, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return err
+	}
+
+	var config map[string]interface{}
+
+	if err := json.Unmarshal(buf, &config); err != nil {
+		return fmt.Errorf("Unable to parse config file %s: %s", file, err.Error())
+	}
+
+	for name, value := range config {
+		if c.IsSet(name) {
+			continue
+		}
+
+		values, ok := value.([]interface{})
+
+		if !ok {
+			values = []interface{}{value}
+		}
+
+		for _, v := range values {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}, nil:
+				return fmt.Errorf("Unsupported value for '%s' in config file %s", name, file)
+			}
+
+			if err := c.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("Unable to set '%s' from config file %s: %s", name, file, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/bernos/cfn-deploy/cfndeploy/term"
+	"io"
+	"os"
+	"strings"
+)
+
+// confirmChanges returns a function that prints the preview of a deployment
+// to out, and asks whether to continue. That function returns true if the
+// answer was yes.
+func confirmChanges(out *os.File) func(*deployer.Preview) (bool, error) {
+	return func(preview *deployer.Preview) (bool, error) {
+		if preview.Exists {
+			fmt.Fprintf(out, "\nChanges to stack %s:\n\n", preview.StackName)
+		} else {
+			fmt.Fprintf(out, "\nStack %s will be created:\n\n", preview.StackName)
+		}
+
+		printResourceChanges(out, preview.Changes, term.IsTerminal(out))
+
+		if len(preview.Parameters) > 0 {
+			fmt.Fprintf(out, "\nParameter changes:\n\n")
+			printParameterChanges(out, preview.Parameters)
+		}
+
+		return askYesNo(out, "\nDeploy these changes?")
+	}
+}
+
+// askYesNo writes question to out, reads the answer from stdin, and returns
+// true if the answer was yes
+func askYesNo(out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes", nil
+}
+
+// printResourceChanges prints a table of resource changes, with the action
+// coloured if colour is true
+func printResourceChanges(w io.Writer, changes []*deployer.ResourceChange, colour bool) {
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "  No resource changes\n")
+		return
+	}
+
+	rows := [][]string{{"ACTION", "RESOURCE", "TYPE", "REPLACEMENT"}}
+
+	for _, c := range changes {
+		rows = append(rows, []string{
+			aws.StringValue(c.Action),
+			c.Path,
+			aws.StringValue(c.ResourceType),
+			aws.StringValue(c.Replacement),
+		})
+	}
+
+	widths := make([]int, len(rows[0]))
+
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	for i, row := range rows {
+		var cells []string
+
+		for j, cell := range row {
+			cells = append(cells, fmt.Sprintf("%-*s", widths[j], cell))
+		}
+
+		if colour && i > 0 {
+			if c, ok := actionColour(changes[i-1]); ok {
+				cells[0] = term.Colourize(c, cells[0])
+			}
+		}
+
+		fmt.Fprintf(w, "  %s\n", strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+}
+
+// actionColour returns the colour to show the action of a change in
+func actionColour(c *deployer.ResourceChange) (term.Colour, bool) {
+	if c.IsDestructive() {
+		return term.Red, true
+	}
+
+	switch aws.StringValue(c.Action) {
+	case cloudformation.ChangeActionAdd:
+		return term.Green, true
+	case cloudformation.ChangeActionModify:
+		return term.Yellow, true
+	}
+
+	return 0, false
+}
+
+// printParameterChanges prints a list of parameter changes
+func printParameterChanges(w io.Writer, changes []deployer.ParameterChange) {
+	for _, p := range changes {
+		fmt.Fprintf(w, "  %s: '%s' => '%s'\n", p.Key, p.Current, p.Desired)
+	}
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/bernos/cfn-deploy/cfndeploy/term"
+	"github.com/codegangsta/cli"
+	"os"
+)
+
+// Delete deletes a stack, after asking for confirmation unless the yes flag is
+// set
+func Delete(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateStackContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "delete")
+		os.Exit(1)
+	}
+
+	stackName := c.String("stackname")
+
+	if !c.Bool("yes") {
+		if !(term.IsTerminal(os.Stdin) && term.IsTerminal(messageOutput(c))) {
+			fmt.Printf("Error! Deleting a stack without an interactive terminal requires the yes flag\n")
+			os.Exit(1)
+		}
+
+		ok, err := askYesNo(messageOutput(c), fmt.Sprintf("Delete stack %s?", stackName))
+
+		if err != nil {
+			fmt.Printf("Error! %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		if !ok {
+			fmt.Fprintf(messageOutput(c), "Delete cancelled\n")
+			os.Exit(1)
+		}
+	}
+
+	f, err := newEventFormatter(c)
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	dep, err := newDeployer(c, f)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	err = dep.Delete(&deployer.DeleteOptions{
+		StackName:       stackName,
+		RetainResources: c.StringSlice("retain-resource"),
+		ServiceRoleARN:  c.String("cfn-role-arn"),
+	})
+	f.Close()
+
+	if err != nil {
+		fmt.Fprintf(messageOutput(c), "Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(messageOutput(c), "Stack %s deleted\n", stackName)
+}
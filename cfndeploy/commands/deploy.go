@@ -2,14 +2,16 @@ package commands
 
 import (
 	"fmt"
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cloudformation"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
-	"github.com/bernos/cfn-deploy/cfndeploy/uploader"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"github.com/bernos/cfn-deploy/cfndeploy/history"
+	"github.com/bernos/cfn-deploy/cfndeploy/lock"
+	"github.com/bernos/cfn-deploy/cfndeploy/term"
+	"github.com/bernos/cfn-deploy/cfndeploy/timeline"
 	"github.com/codegangsta/cli"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -20,6 +22,22 @@ func validateRequiredStringParam(param string, c *cli.Context) error {
 	return nil
 }
 
+// validateStackContext validates the params that identify an existing stack
+func validateStackContext(c *cli.Context) error {
+	ps := []string{
+		"stackname",
+		"region",
+	}
+
+	for _, p := range ps {
+		if err := validateRequiredStringParam(p, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func validateDeployContext(c *cli.Context) error {
 	ps := []string{
 		"stackname",
@@ -38,58 +56,253 @@ func validateDeployContext(c *cli.Context) error {
 		return fmt.Errorf("Expected template folder as argument")
 	}
 
+	if format := c.String("timeline-format"); format != timeline.JSONFormat && format != timeline.TraceFormat {
+		return fmt.Errorf("Invalid timeline-format '%s'. Expected %s or %s", format, timeline.JSONFormat, timeline.TraceFormat)
+	}
+
 	return nil
 }
 
 func Deploy(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Fprintf(messageOutput(c), "Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
 	if err := validateDeployContext(c); err != nil {
-		fmt.Printf("Error! %s\n", err.Error())
+		fmt.Fprintf(messageOutput(c), "Error! %s\n", err.Error())
 		cli.ShowCommandHelp(c, "deploy")
 		os.Exit(1)
 	}
 
-	params, err := parseMap(c.String("params"))
+	if c.Bool("confirm") && !(term.IsTerminal(os.Stdin) && term.IsTerminal(messageOutput(c))) {
+		fmt.Fprintf(messageOutput(c), "Error! The confirm flag requires an interactive terminal\n")
+		os.Exit(1)
+	}
+
+	options, err := buildDeployOptions(c)
 
 	if err != nil {
-		fmt.Printf("Error! %s", err.Error())
+		fmt.Fprintf(messageOutput(c), "Error! %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	tags, err := parseMap(c.String("tags"))
+	f, err := newEventFormatter(c)
 
 	if err != nil {
-		fmt.Printf("Error! %s", err.Error())
+		fmt.Fprintf(messageOutput(c), "Error! %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	options := &deployer.DeployOptions{
-		StackName:      c.String("stackname"),
-		TemplateFolder: c.Args().First(),
-		MainTemplate:   c.String("main"),
-		Region:         c.String("region"),
-		Bucket:         c.String("bucket"),
-		BucketFolder:   c.String("bucketfolder"),
-		StackParams:    deployer.StackParams(params),
-		StackTags:      deployer.StackTags(tags),
-	}
-
-	if err := options.Validate(); err != nil {
-		fmt.Printf("Error! %s", err.Error())
+	recorder := &timeline.Recorder{}
+	f = events.Multi(f, recorder)
+
+	cfnSess, s3Sess, err := newSessions(c)
+
+	if err != nil {
+		fmt.Fprintf(messageOutput(c), "Error! %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	sess := session.New(&aws.Config{Region: aws.String(options.Region)})
-	s3 := s3manager.NewUploader(sess)
-	cfn := cloudformation.New(sess)
-	upl := uploader.New(s3)
-	dep := deployer.New(cfn, upl)
+	dep := buildDeployer(c, f, cfnSess, s3Sess)
 
-	if err := dep.Deploy(options); err != nil {
-		fmt.Printf("Error! %s", err.Error())
+	if c.Bool("confirm") {
+		options.Approve = confirmChanges(messageOutput(c))
+	}
+
+	recordDeployment(c, options, cfnSess)
+
+	err = dep.Deploy(options)
+	f.Close()
+
+	if terr := writeTimeline(c, recorder.Timeline()); terr != nil {
+		fmt.Fprintf(messageOutput(c), "Unable to write timeline: %s\n", terr.Error())
+	}
+
+	if err == deployer.ErrNotApproved {
+		fmt.Fprintf(messageOutput(c), "Deployment cancelled\n")
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(messageOutput(c), "Error! %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	fmt.Printf("Deployment sucessful!\n")
+	fmt.Fprintf(messageOutput(c), "Deployment sucessful!\n")
+}
+
+// buildDeployOptions builds and validates DeployOptions from the command line
+func buildDeployOptions(c *cli.Context) (*deployer.DeployOptions, error) {
+	params, tags, err := paramsAndTags(c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	options := &deployer.DeployOptions{
+		StackName:          c.String("stackname"),
+		TemplateFolder:     c.Args().First(),
+		MainTemplate:       c.String("main"),
+		Region:             c.String("region"),
+		Bucket:             c.String("bucket"),
+		BucketFolder:       c.String("bucketfolder"),
+		StackParams:        deployer.StackParams(params),
+		StackTags:          deployer.StackTags(tags),
+		ServiceRoleARN:     c.String("cfn-role-arn"),
+		NotificationARNs:   c.StringSlice("notification-arn"),
+		TimeoutInMinutes:   c.Int64("timeout-in-minutes"),
+		OnFailure:          c.String("on-failure"),
+		DisableRollback:    c.Bool("disable-rollback"),
+		ClientRequestToken: c.String("client-request-token"),
+		AllowReplace:       c.StringSlice("allow-replace"),
+		AllowDestructive:   c.Bool("allow-destructive"),
+		WaitTimeout:        c.Duration("wait-timeout"),
+		Lock:               c.Bool("lock"),
+		LockOwner:          c.String("lock-owner"),
+		LockTTL:            c.Duration("lock-ttl"),
+		LockTimeout:        c.Duration("lock-timeout"),
+	}
+
+	if options.TemplateVars, err = templateVars(c); err != nil {
+		return nil, err
+	}
+
+	if c.Bool("no-notification-arns") {
+		if len(options.NotificationARNs) > 0 {
+			return nil, fmt.Errorf("The notification-arn and no-notification-arns flags can not be used together")
+		}
+
+		options.NotificationARNs = []string{}
+	}
+
+	if types := c.StringSlice("protected-resource-type"); len(types) > 0 {
+		options.ProtectedResourceTypes = types
+	}
+
+	if s := c.String("termination-protection"); s != "" {
+		enable, err := strconv.ParseBool(s)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid termination-protection value '%s'. Expected true or false", s)
+		}
+
+		options.TerminationProtection = &enable
+	}
+
+	if alarms := c.StringSlice("rollback-alarm-arn"); len(alarms) > 0 || c.IsSet("rollback-monitoring-period") {
+		options.RollbackConfiguration = &deployer.RollbackConfiguration{
+			AlarmARNs:        alarms,
+			MonitoringPeriod: c.Duration("rollback-monitoring-period"),
+		}
+	}
+
+	if file := c.String("stack-policy-file"); file != "" {
+		if options.StackPolicy, err = deployer.LoadStackPolicy(file); err != nil {
+			return nil, err
+		}
+	}
+
+	if file := c.String("stack-policy-during-update-file"); file != "" {
+		if options.StackPolicyDuringUpdate, err = deployer.LoadStackPolicy(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return options, options.Validate()
+}
+
+// writeTimeline prints the timeline of a deployment, and writes it to the
+// timeline file if one was given
+func writeTimeline(c *cli.Context, t *timeline.Timeline) error {
+	if len(t.Spans) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(messageOutput(c), "\nTimeline of stack %s:\n\n", t.StackName)
+	t.WriteSummary(messageOutput(c))
+
+	file := c.String("timeline-file")
+
+	if file == "" {
+		return nil
+	}
+
+	out, err := os.Create(file)
+
+	if err != nil {
+		return err
+	}
+
+	if err := t.Write(out, c.String("timeline-format")); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// newDeployer builds a Deployer using the connection and credential settings
+// from the command line. Stack events are written to f, or as text to stderr
+// if f is nil.
+func newDeployer(c *cli.Context, f events.Formatter) (deployer.Deployer, error) {
+	cfnSess, s3Sess, err := newSessions(c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buildDeployer(c, f, cfnSess, s3Sess), nil
+}
+
+// buildDeployer builds a Deployer that uses the given sessions for
+// cloudformation and S3
+func buildDeployer(c *cli.Context, f events.Formatter, cfnSess, s3Sess *session.Session) deployer.Deployer {
+	cfn := newCloudFormation(c, cfnSess)
+	s3 := newS3(c, s3Sess)
+	upl := newUploader(c, s3)
+
+	return deployer.New(cfn, upl, lock.New(s3), history.New(s3), f)
+}
+
+// paramsAndTags returns the stack parameters and tags read from the params
+// file, overridden by those given with the params and tags flags
+func paramsAndTags(c *cli.Context) (map[string]string, map[string]string, error) {
+	params, err := parseMap(c.String("params"))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags, err := parseMap(c.String("tags"))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file := c.String("params-file")
+
+	if file == "" {
+		return params, tags, nil
+	}
+
+	p, err := readParamsFile(file)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for k, v := range p.Parameters {
+		if _, ok := params[k]; !ok {
+			params[k] = v
+		}
+	}
+
+	for k, v := range p.Tags {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+
+	return params, tags, nil
 }
 
 func parseMap(s string) (map[string]string, error) {
@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/bernos/cfn-deploy/cfndeploy/term"
+	"github.com/codegangsta/cli"
+	"io"
+	"os"
+)
+
+func validateDiffContext(c *cli.Context) error {
+	ps := []string{
+		"stackname",
+		"main",
+		"region",
+	}
+
+	for _, p := range ps {
+		if err := validateRequiredStringParam(p, c); err != nil {
+			return err
+		}
+	}
+
+	if c.NArg() != 1 {
+		return fmt.Errorf("Expected template folder as argument")
+	}
+
+	return nil
+}
+
+// Diff compares the local templates, parameters and tags with those of the
+// deployed stack and its nested stacks, and prints the differences
+func Diff(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateDiffContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "diff")
+		os.Exit(1)
+	}
+
+	options, err := buildDeployOptions(c)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	dep, err := newDeployer(c, nil)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	diff, err := dep.Diff(options)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	printDiff(os.Stdout, diff, term.IsTerminal(os.Stdout))
+}
+
+// printDiff prints the template changes grouped by stack, followed by the
+// parameter and tag changes
+func printDiff(w io.Writer, diff *deployer.Diff, colour bool) {
+	for _, t := range diff.Templates {
+		name := diff.StackName
+
+		if t.Path != "" {
+			name = fmt.Sprintf("%s (%s)", t.Path, t.Template)
+		}
+
+		switch {
+		case t.Template == "":
+			fmt.Fprintf(w, "%s: no local template found\n", t.Path)
+		case len(t.Changes) == 0:
+			fmt.Fprintf(w, "%s: no changes\n", name)
+		default:
+			fmt.Fprintf(w, "%s:\n", name)
+
+			for _, change := range t.Changes {
+				printTemplateChange(w, change, colour)
+			}
+		}
+	}
+
+	printSettingChanges(w, "Parameters", diff.Parameters, colour)
+	printSettingChanges(w, "Tags", diff.Tags, colour)
+}
+
+// printTemplateChange prints a single template change
+func printTemplateChange(w io.Writer, change *deployer.TemplateChange, colour bool) {
+	var line string
+
+	switch change.Kind {
+	case deployer.TemplateChangeAdd:
+		line = fmt.Sprintf("  + %s: %s", change.Path, formatValue(change.Local))
+	case deployer.TemplateChangeRemove:
+		line = fmt.Sprintf("  - %s: %s", change.Path, formatValue(change.Live))
+	default:
+		line = fmt.Sprintf("  ~ %s: %s => %s", change.Path, formatValue(change.Live), formatValue(change.Local))
+	}
+
+	fmt.Fprintln(w, changeColour(line, change.Kind, colour))
+}
+
+// printSettingChanges prints parameter or tag changes under a heading
+func printSettingChanges(w io.Writer, heading string, changes []deployer.ParameterChange, colour bool) {
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "%s:\n", heading)
+
+	for _, change := range changes {
+		var line, kind string
+
+		switch {
+		case change.Current == "":
+			kind = deployer.TemplateChangeAdd
+			line = fmt.Sprintf("  + %s: '%s'", change.Key, change.Desired)
+		case change.Desired == "":
+			kind = deployer.TemplateChangeRemove
+			line = fmt.Sprintf("  - %s: '%s'", change.Key, change.Current)
+		default:
+			kind = deployer.TemplateChangeModify
+			line = fmt.Sprintf("  ~ %s: '%s' => '%s'", change.Key, change.Current, change.Desired)
+		}
+
+		fmt.Fprintln(w, changeColour(line, kind, colour))
+	}
+}
+
+// changeColour colours a line by the kind of change
+func changeColour(line, kind string, colour bool) string {
+	if !colour {
+		return line
+	}
+
+	switch kind {
+	case deployer.TemplateChangeAdd:
+		return term.Colourize(term.Green, line)
+	case deployer.TemplateChangeRemove:
+		return term.Colourize(term.Red, line)
+	}
+	return term.Colourize(term.Yellow, line)
+}
+
+// formatValue formats a template value as compact JSON
+func formatValue(value interface{}) string {
+	buf, err := json.Marshal(value)
+
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(buf)
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/bernos/cfn-deploy/cfndeploy/term"
+	"github.com/codegangsta/cli"
+	"io"
+	"os"
+)
+
+// driftExitCode is the exit code of the drift command when drift is found,
+// which distinguishes drift from errors
+const driftExitCode = 2
+
+// Drift detects drift of a stack and its nested stacks, and prints the
+// resources that have drifted with their property differences
+func Drift(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateStackContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "drift")
+		os.Exit(1)
+	}
+
+	dep, err := newDeployer(c, nil)
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	drifts, err := dep.Drift(c.String("stackname"))
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if len(drifts) == 0 {
+		fmt.Printf("Stack %s has not drifted\n", c.String("stackname"))
+		return
+	}
+
+	fmt.Printf("\nResources of stack %s that have drifted:\n\n", c.String("stackname"))
+	printDrifts(os.Stdout, drifts, term.IsTerminal(os.Stdout))
+
+	os.Exit(driftExitCode)
+}
+
+// printDrifts prints each drifted resource, followed by the differences
+// between its expected and actual properties
+func printDrifts(w io.Writer, drifts []*deployer.ResourceDrift, colour bool) {
+	for _, d := range drifts {
+		status := aws.StringValue(d.StackResourceDriftStatus)
+
+		if colour {
+			c := term.Yellow
+
+			if status == cloudformation.StackResourceDriftStatusDeleted {
+				c = term.Red
+			}
+
+			status = term.Colourize(c, status)
+		}
+
+		fmt.Fprintf(w, "  %s %s (%s)\n", status, d.Path, aws.StringValue(d.ResourceType))
+
+		for _, p := range d.PropertyDifferences {
+			fmt.Fprintf(w, "    %s %s: expected %s, actual %s\n",
+				differenceSymbol(aws.StringValue(p.DifferenceType)),
+				aws.StringValue(p.PropertyPath),
+				aws.StringValue(p.ExpectedValue),
+				aws.StringValue(p.ActualValue))
+		}
+	}
+}
+
+// differenceSymbol returns the symbol shown for a type of property difference
+func differenceSymbol(differenceType string) string {
+	switch differenceType {
+	case cloudformation.DifferenceTypeAdd:
+		return "+"
+	case cloudformation.DifferenceTypeRemove:
+		return "-"
+	}
+	return "~"
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"github.com/bernos/cfn-deploy/cfndeploy/term"
+	"github.com/codegangsta/cli"
+	"os"
+)
+
+// newEventFormatter builds a Formatter that writes stack events to stdout in
+// the format given by the output flag. Text output is coloured on a terminal.
+func newEventFormatter(c *cli.Context) (events.Formatter, error) {
+	output := c.String("output")
+	colour := output != events.JSONOutput && output != events.NDJSONOutput && term.IsTerminal(os.Stdout)
+
+	return events.New(output, os.Stdout, colour)
+}
+
+// messageOutput returns the writer for messages other than stack events. When
+// events are written as JSON, messages go to stderr so that stdout holds only
+// the JSON.
+func messageOutput(c *cli.Context) *os.File {
+	if output := c.String("output"); output == events.JSONOutput || output == events.NDJSONOutput {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Events shows the events of the most recent operation on a stack and its
+// nested stacks, and optionally follows the operation until it finishes
+func Events(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateStackContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "events")
+		os.Exit(1)
+	}
+
+	f, err := newEventFormatter(c)
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	dep, err := newDeployer(c, f)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	err = dep.Events(&deployer.EventsOptions{
+		StackName: c.String("stackname"),
+		Follow:    c.Bool("follow"),
+		Timeout:   c.Duration("wait-timeout"),
+	})
+	f.Close()
+
+	if err != nil {
+		fmt.Fprintf(messageOutput(c), "Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,234 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/bernos/cfn-deploy/cfndeploy/history"
+	"github.com/codegangsta/cli"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func validateHistoryContext(c *cli.Context) error {
+	ps := []string{
+		"stackname",
+		"region",
+		"bucket",
+	}
+
+	for _, p := range ps {
+		if err := validateRequiredStringParam(p, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HistoryList lists the recorded deployments of a stack, oldest first
+func HistoryList(c *cli.Context) {
+	entries := historyEntries(c, "list")
+
+	if len(entries) == 0 {
+		fmt.Printf("No deployments of stack %s have been recorded\n", c.String("stackname"))
+		return
+	}
+
+	printHistory(os.Stdout, entries)
+}
+
+// HistoryShow shows a single recorded deployment of a stack, given by its
+// number in the list or by its version
+func HistoryShow(c *cli.Context) {
+	if c.NArg() != 1 {
+		fmt.Printf("Error! Expected entry number or version as argument\n")
+		cli.ShowCommandHelp(c, "show")
+		os.Exit(1)
+	}
+
+	entry, err := history.Find(historyEntries(c, "show"), c.Args().First())
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	printEntry(os.Stdout, entry)
+}
+
+// historyEntries reads the recorded deployments of the stack given on the
+// command line
+func historyEntries(c *cli.Context, command string) []*history.Entry {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateHistoryContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, command)
+		os.Exit(1)
+	}
+
+	_, s3Sess, err := newSessions(c)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	entries, err := history.New(newS3(c, s3Sess)).List(c.String("bucket"), c.String("bucketfolder"), c.String("stackname"))
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	return entries
+}
+
+// printHistory prints a table of deployments
+func printHistory(w io.Writer, entries []*history.Entry) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "#\tSTARTED\tDURATION\tVERSION\tSTATUS\tCALLER\tCOMMIT\n")
+
+	for i, e := range entries {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1,
+			e.Start.Local().Format(time.RFC3339),
+			e.Duration().Round(time.Second),
+			e.Version,
+			e.Status,
+			callerName(e.Caller),
+			shortCommit(e.GitCommit))
+	}
+
+	tw.Flush()
+}
+
+// printEntry prints all details of a deployment
+func printEntry(w io.Writer, e *history.Entry) {
+	fmt.Fprintf(w, "Stack:      %s\n", e.StackName)
+	fmt.Fprintf(w, "Version:    %s\n", e.Version)
+	fmt.Fprintf(w, "Status:     %s\n", e.Status)
+
+	if e.Error != "" {
+		fmt.Fprintf(w, "Error:      %s\n", e.Error)
+	}
+
+	fmt.Fprintf(w, "Started:    %s\n", e.Start.Local().Format(time.RFC3339))
+	fmt.Fprintf(w, "Finished:   %s (%s)\n", e.End.Local().Format(time.RFC3339), e.Duration().Round(time.Second))
+
+	if e.Caller != nil {
+		fmt.Fprintf(w, "Caller:     %s (account %s)\n", e.Caller.ARN, e.Caller.Account)
+	}
+
+	if e.GitCommit != "" {
+		fmt.Fprintf(w, "Git commit: %s\n", e.GitCommit)
+	}
+
+	fmt.Fprintf(w, "cfndeploy:  %s\n", e.CfndeployVersion)
+
+	printValues(w, "Templates", e.Templates)
+	printValues(w, "Parameters", e.Parameters)
+	printValues(w, "Tags", e.Tags)
+}
+
+// printValues prints a heading, followed by the values of m sorted by key
+func printValues(w io.Writer, heading string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+
+	var keys []string
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "%s:\n", heading)
+
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s: %s\n", k, m[k])
+	}
+}
+
+// callerName returns the name of the caller, without the role or user path
+func callerName(caller *history.Caller) string {
+	if caller == nil {
+		return "-"
+	}
+
+	return caller.ARN[strings.LastIndex(caller.ARN, ":")+1:]
+}
+
+// shortCommit abbreviates a git commit
+func shortCommit(commit string) string {
+	if commit == "" {
+		return "-"
+	}
+
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+
+	return commit
+}
+
+// recordDeployment sets the details that are recorded in the history of the
+// deployment. The caller identity is found with sess, the session used for
+// cloudformation. Details that can not be found are left out.
+func recordDeployment(c *cli.Context, options *deployer.DeployOptions, sess *session.Session) {
+	options.CfndeployVersion = c.App.Version
+	options.GitCommit = c.String("git-commit")
+
+	if options.GitCommit == "" {
+		options.GitCommit = gitCommit(options.TemplateFolder)
+	}
+
+	caller, err := callerIdentity(sess)
+
+	if err != nil {
+		fmt.Fprintf(messageOutput(c), "Unable to find caller identity for the deployment history: %s\n", err.Error())
+		return
+	}
+
+	options.Caller = caller
+}
+
+// callerIdentity returns the identity of sess, which performs stack
+// operations
+func callerIdentity(sess *session.Session) (*history.Caller, error) {
+	resp, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &history.Caller{
+		Account: aws.StringValue(resp.Account),
+		ARN:     aws.StringValue(resp.Arn),
+		UserID:  aws.StringValue(resp.UserId),
+	}, nil
+}
+
+// gitCommit returns the commit checked out in the git repository holding
+// folder, or an empty string if folder is not in a git repository
+func gitCommit(folder string) string {
+	out, err := exec.Command("git", "-C", folder, "rev-parse", "HEAD").Output()
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
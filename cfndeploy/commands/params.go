@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// paramsFile is the format of the file given by the params-file flag, which
+// is written by the pull command. Unlike the params and tags flags, values may
+// hold commas and equals signs.
+type paramsFile struct {
+	Parameters map[string]string `json:"Parameters"`
+	Tags       map[string]string `json:"Tags"`
+}
+
+// readParamsFile reads the parameters and tags in a params file
+func readParamsFile(file string) (*paramsFile, error) {
+	buf, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var p paramsFile
+
+	if err := json.Unmarshal(buf, &p); err != nil {
+		return nil, fmt.Errorf("Unable to parse params file %s: %s", file, err.Error())
+	}
+
+	return &p, nil
+}
+
+// writeParamsFile writes parameters and tags to a params file
+func writeParamsFile(file string, p *paramsFile) error {
+	buf, err := json.MarshalIndent(p, "", "    ")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, append(buf, '\n'), 0644)
+}
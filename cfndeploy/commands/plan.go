@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"os"
+)
+
+func validatePlanContext(c *cli.Context) error {
+	ps := []string{
+		"stackname",
+		"region",
+	}
+
+	for _, p := range ps {
+		if err := validateRequiredStringParam(p, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func Plan(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validatePlanContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "plan")
+		os.Exit(1)
+	}
+
+	options, err := buildDeployOptions(c)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	dep, err := newDeployer(c, nil)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	plan, err := dep.Plan(options)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	if !plan.Exists {
+		fmt.Printf("Stack %s does not exist, and will be created\n", plan.StackName)
+		return
+	}
+
+	if len(plan.Settings) == 0 {
+		fmt.Printf("No changes to stack settings\n")
+		return
+	}
+
+	fmt.Printf("Changes to stack settings:\n")
+
+	for _, s := range plan.Settings {
+		note := ""
+
+		if s.CreateOnly {
+			note = " (only applied when the stack is created)"
+		}
+
+		fmt.Printf("  %s: '%s' => '%s'%s\n", s.Name, s.Current, s.Desired, note)
+	}
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/codegangsta/cli"
+	"os"
+)
+
+func PolicyShow(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateStackContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "show")
+		os.Exit(1)
+	}
+
+	dep, err := newDeployer(c, nil)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	policy, err := dep.StackPolicy(c.String("stackname"))
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	if policy == "" {
+		fmt.Printf("Stack %s has no stack policy\n", c.String("stackname"))
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if err := json.Indent(&buf, []byte(policy), "", "    "); err != nil {
+		fmt.Printf("%s\n", policy)
+		return
+	}
+
+	fmt.Printf("%s\n", buf.String())
+}
+
+func PolicySet(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateStackContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "set")
+		os.Exit(1)
+	}
+
+	if c.NArg() != 1 {
+		fmt.Printf("Error! Expected stack policy file as argument\n")
+		cli.ShowCommandHelp(c, "set")
+		os.Exit(1)
+	}
+
+	policy, err := deployer.LoadStackPolicy(c.Args().First())
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	dep, err := newDeployer(c, nil)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	if err := dep.SetStackPolicy(c.String("stackname"), policy); err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Stack policy updated\n")
+}
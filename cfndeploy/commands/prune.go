@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/pruner"
+	"github.com/codegangsta/cli"
+	"os"
+)
+
+func validatePruneContext(c *cli.Context) error {
+	ps := []string{
+		"stackname",
+		"region",
+		"bucket",
+	}
+
+	for _, p := range ps {
+		if err := validateRequiredStringParam(p, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func Prune(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validatePruneContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "prune")
+		os.Exit(1)
+	}
+
+	options := &pruner.PruneOptions{
+		StackName:    c.String("stackname"),
+		Bucket:       c.String("bucket"),
+		BucketFolder: c.String("bucketfolder"),
+		Keep:         c.Int("keep"),
+		MinAge:       c.Duration("min-age"),
+		DryRun:       c.Bool("dry-run"),
+	}
+
+	if err := options.Validate(); err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	cfnSess, s3Sess, err := newSessions(c)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	p := pruner.New(newCloudFormation(c, cfnSess), newS3(c, s3Sess))
+
+	versions, err := p.Prune(options)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	action := "Deleted"
+
+	if options.DryRun {
+		action = "Would delete"
+	}
+
+	for _, v := range versions {
+		fmt.Printf("%s %s (%d objects, last modified %s)\n", action, v.Prefix, len(v.Keys), v.LastModified.Format("2006-01-02 15:04:05"))
+	}
+
+	fmt.Printf("%s %d versions\n", action, len(versions))
+}
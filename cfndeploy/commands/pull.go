@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/codegangsta/cli"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func validatePullContext(c *cli.Context) error {
+	ps := []string{
+		"stackname",
+		"region",
+		"out",
+		"main",
+	}
+
+	for _, p := range ps {
+		if err := validateRequiredStringParam(p, c); err != nil {
+			return err
+		}
+	}
+
+	if isWithin(c.String("out"), pullParamsFile(c)) {
+		return fmt.Errorf("The params file must be outside the template folder")
+	}
+
+	return nil
+}
+
+// Pull exports a deployed stack and its nested stacks to a template folder,
+// and writes its parameters and tags to a params file
+func Pull(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validatePullContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "pull")
+		os.Exit(1)
+	}
+
+	file := pullParamsFile(c)
+
+	if _, err := os.Stat(file); err == nil && !c.Bool("force") {
+		fmt.Printf("Error! Params file %s already exists\n", file)
+		os.Exit(1)
+	}
+
+	dep, err := newDeployer(c, nil)
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	pulled, err := dep.Pull(&deployer.PullOptions{
+		StackName:      c.String("stackname"),
+		TemplateFolder: c.String("out"),
+		MainTemplate:   c.String("main"),
+		Overwrite:      c.Bool("force"),
+	})
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := writeParamsFile(file, &paramsFile{Parameters: pulled.Params, Tags: pulled.Tags}); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wrote templates to %s:\n", c.String("out"))
+
+	for _, t := range pulled.Templates {
+		fmt.Printf("  %s\n", t)
+	}
+
+	fmt.Printf("Wrote parameters and tags to %s\n", file)
+
+	if len(pulled.NoEchoParams) > 0 {
+		fmt.Printf("The values of NoEcho parameters can not be read, and must be given when deploying: %s\n", strings.Join(pulled.NoEchoParams, ", "))
+	}
+}
+
+// pullParamsFile returns the file the pull command writes parameters and tags
+// to
+func pullParamsFile(c *cli.Context) string {
+	if file := c.String("params-file"); file != "" {
+		return file
+	}
+
+	return c.String("stackname") + ".params.json"
+}
+
+// isWithin returns true if file is inside folder
+func isWithin(folder, file string) bool {
+	rel, err := filepath.Rel(folder, file)
+
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// templateVarEnvPrefix is the prefix of environment variables that are used as
+// template variables
+const templateVarEnvPrefix = "CFNDEPLOY_VAR_"
+
+func validateRenderContext(c *cli.Context) error {
+	if err := validateRequiredStringParam("out", c); err != nil {
+		return err
+	}
+
+	if c.NArg() != 1 {
+		return fmt.Errorf("Expected template folder as argument")
+	}
+
+	return nil
+}
+
+// Render renders the templates in a template folder, and writes the files that
+// would be uploaded to the output folder
+func Render(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateRenderContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "render")
+		os.Exit(1)
+	}
+
+	vars, err := templateVars(c)
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	files, err := deployer.Render(c.Args().First(), c.String("out"), vars)
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	for _, file := range files {
+		fmt.Println(file)
+	}
+}
+
+// templateVars builds the template variables from the environment, the vars
+// file and the var flags, in increasing order of precedence. Environment
+// variables are used without their CFNDEPLOY_VAR_ prefix.
+func templateVars(c *cli.Context) (deployer.TemplateVars, error) {
+	vars := make(deployer.TemplateVars)
+
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, templateVarEnvPrefix) {
+			pair := strings.SplitN(strings.TrimPrefix(kv, templateVarEnvPrefix), "=", 2)
+			vars[pair[0]] = pair[1]
+		}
+	}
+
+	if file := c.String("vars-file"); file != "" {
+		buf, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var fileVars map[string]interface{}
+
+		if err := json.Unmarshal(buf, &fileVars); err != nil {
+			return nil, fmt.Errorf("Unable to parse vars file %s: %s", file, err.Error())
+		}
+
+		for k, v := range fileVars {
+			vars[k] = v
+		}
+	}
+
+	for _, kv := range c.StringSlice("var") {
+		pair := strings.SplitN(kv, "=", 2)
+
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			return nil, fmt.Errorf("Badly formed var '%s'. Expected format 'name=value'", kv)
+		}
+
+		vars[strings.TrimSpace(pair[0])] = pair[1]
+	}
+
+	return vars, nil
+}
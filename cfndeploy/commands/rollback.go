@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/bernos/cfn-deploy/cfndeploy/deployer"
+	"github.com/codegangsta/cli"
+	"os"
+)
+
+func ContinueUpdateRollback(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateStackContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "continue-update-rollback")
+		os.Exit(1)
+	}
+
+	f, err := newEventFormatter(c)
+
+	if err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	dep, err := newDeployer(c, f)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	failures, err := dep.RollbackFailures(c.String("stackname"))
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	if len(failures) > 0 {
+		fmt.Fprintf(messageOutput(c), "Resources that failed to roll back:\n")
+
+		for _, failure := range failures {
+			fmt.Fprintf(messageOutput(c), "  %s (%s) %s: %s\n", failure.Path, aws.StringValue(failure.ResourceType), aws.StringValue(failure.ResourceStatus), aws.StringValue(failure.ResourceStatusReason))
+		}
+	}
+
+	options := &deployer.ContinueUpdateRollbackOptions{
+		StackName:       c.String("stackname"),
+		ResourcesToSkip: c.StringSlice("skip-resource"),
+		ServiceRoleARN:  c.String("cfn-role-arn"),
+	}
+
+	err = dep.ContinueUpdateRollback(options)
+	f.Close()
+
+	if err != nil {
+		fmt.Fprintf(messageOutput(c), "Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(messageOutput(c), "Rollback complete\n")
+}
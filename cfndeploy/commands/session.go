@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/bernos/cfn-deploy/cfndeploy/uploader"
+	"github.com/codegangsta/cli"
+	"net/http"
+)
+
+// newSession builds an AWS session for the region and named profile given on
+// the command line
+func newSession(c *cli.Context) (*session.Session, error) {
+	config := aws.NewConfig().WithRegion(c.String("region"))
+
+	if c.Bool("insecure-skip-verify") {
+		config.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		})
+	}
+
+	return session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		Profile:           c.String("profile"),
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}
+
+// newSessions builds the sessions used for cloudformation and S3. If a role
+// was given on the command line it is assumed for cloudformation, and also
+// for S3 unless the template bucket should be accessed with the source
+// credentials.
+func newSessions(c *cli.Context) (cfnSess, s3Sess *session.Session, err error) {
+	sess, err := newSession(c)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roleARN := c.String("role-arn")
+
+	if roleARN == "" {
+		return sess, sess, nil
+	}
+
+	creds := stscreds.NewCredentials(sess, roleARN, func(p *stscreds.AssumeRoleProvider) {
+		if externalID := c.String("external-id"); externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+		if sessionName := c.String("role-session-name"); sessionName != "" {
+			p.RoleSessionName = sessionName
+		}
+		if duration := c.Duration("role-duration"); duration > 0 {
+			p.Duration = duration
+		}
+	})
+
+	if _, err := creds.Get(); err != nil {
+		return nil, nil, fmt.Errorf("Unable to assume role %s: %s", roleARN, err.Error())
+	}
+
+	roleSess := sess.Copy(&aws.Config{Credentials: creds})
+
+	if c.Bool("bucket-source-credentials") {
+		return roleSess, sess, nil
+	}
+
+	return roleSess, roleSess, nil
+}
+
+// newCloudFormation builds a cloudformation client, using a custom endpoint
+// if one was given on the command line
+func newCloudFormation(c *cli.Context, sess *session.Session) *cloudformation.CloudFormation {
+	config := aws.NewConfig()
+
+	if endpoint := c.String("cfn-endpoint"); endpoint != "" {
+		config.WithEndpoint(endpoint)
+	}
+
+	return cloudformation.New(sess, config)
+}
+
+// newS3 builds an S3 client, using a custom endpoint and path style
+// addressing if they were given on the command line
+func newS3(c *cli.Context, sess *session.Session) *s3.S3 {
+	config := aws.NewConfig().WithS3ForcePathStyle(c.Bool("s3-path-style"))
+
+	if endpoint := c.String("s3-endpoint"); endpoint != "" {
+		config.WithEndpoint(endpoint)
+	}
+
+	return s3.New(sess, config)
+}
+
+// newUploader builds an uploader that uploads templates with the given S3
+// client
+func newUploader(c *cli.Context, svc *s3.S3) uploader.Uploader {
+	s3 := s3manager.NewUploaderWithClient(svc)
+
+	if endpoint := c.String("s3-endpoint"); endpoint != "" {
+		return uploader.NewWithEndpoint(s3, endpoint, c.Bool("s3-path-style"))
+	}
+
+	return uploader.New(s3)
+}
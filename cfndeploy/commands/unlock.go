@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/lock"
+	"github.com/codegangsta/cli"
+	"os"
+)
+
+func validateUnlockContext(c *cli.Context) error {
+	ps := []string{
+		"stackname",
+		"region",
+		"bucket",
+	}
+
+	for _, p := range ps {
+		if err := validateRequiredStringParam(p, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func Unlock(c *cli.Context) {
+	if err := loadConfig(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := validateUnlockContext(c); err != nil {
+		fmt.Printf("Error! %s\n", err.Error())
+		cli.ShowCommandHelp(c, "unlock")
+		os.Exit(1)
+	}
+
+	_, s3Sess, err := newSessions(c)
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	bucket := c.String("bucket")
+	key := lock.Key(c.String("stackname"), c.String("bucketfolder"))
+	l := lock.New(newS3(c, s3Sess))
+
+	current, err := l.Current(bucket, key)
+
+	if err == lock.ErrNotLocked {
+		fmt.Printf("Stack %s is not locked\n", c.String("stackname"))
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Stack %s is locked by %s\n", c.String("stackname"), current)
+
+	if !c.Bool("force") {
+		fmt.Printf("Use --force to remove the lock\n")
+		os.Exit(1)
+	}
+
+	if err := l.ForceUnlock(bucket, key); err != nil {
+		fmt.Printf("Error! %s", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Lock removed\n")
+}
@@ -0,0 +1,155 @@
+package deployer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// build holds copies of the templates in a template folder, staged in a
+// temporary directory so that they can be rewritten before they are
+// uploaded. The source templates are never modified.
+type build struct {
+	// dir is the temporary directory holding the build
+	dir string
+
+	// templateDir is the directory holding the staged templates
+	templateDir string
+
+	// artifactDir is the directory holding packaged artifacts
+	artifactDir string
+
+	mainTemplate string
+	templates    []string
+	artifacts    []*artifact
+
+	// sources maps each staged template to the file it was staged from
+	sources map[string]string
+}
+
+// newBuild stages all files in folder in a new temporary directory. Files
+// ending in .tmpl are rendered with vars, then include directives are
+// resolved. The main template may be empty if it
+// is not needed. Close must be called to remove the directory once the build
+// is no longer needed.
+func newBuild(folder, mainTemplate string, vars TemplateVars) (*build, error) {
+	files, err := findTemplates(folder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "cfndeploy")
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := &build{
+		dir:         dir,
+		templateDir: filepath.Join(dir, "templates"),
+		artifactDir: filepath.Join(dir, "artifacts"),
+		sources:     make(map[string]string),
+	}
+
+	for _, file := range files {
+		staged, err := b.stagedPath(folder, file)
+
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+
+		if source, ok := b.sources[staged]; ok {
+			b.Close()
+			return nil, fmt.Errorf("Both %s and %s are staged as %s", source, file, staged)
+		}
+
+		if isTemplateSource(file) {
+			err = renderTemplate(file, staged, vars)
+		} else {
+			err = copyFile(file, staged)
+		}
+
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+
+		b.templates = append(b.templates, staged)
+		b.sources[staged] = file
+	}
+
+	if err := b.resolveIncludes(); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	if mainTemplate != "" {
+		if b.mainTemplate, err = b.stagedPath(folder, mainTemplate); err != nil {
+			b.Close()
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// Close removes the temporary directory holding the build
+func (b *build) Close() error {
+	return os.RemoveAll(b.dir)
+}
+
+// files returns all staged templates and packaged artifacts
+func (b *build) files() []string {
+	files := append([]string{}, b.templates...)
+
+	for _, a := range b.artifacts {
+		files = append(files, a.file)
+	}
+
+	return files
+}
+
+// stagedPath returns the path that file in folder is staged at. Templates
+// that are rendered are staged without their .tmpl suffix.
+func (b *build) stagedPath(folder, file string) (string, error) {
+	rel, err := filepath.Rel(folder, file)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(b.templateDir, strings.TrimSuffix(rel, templateSuffix)), nil
+}
+
+// copyFile copies src to dst, creating the parent directories of dst
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.Create(dst)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
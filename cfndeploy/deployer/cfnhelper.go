@@ -7,12 +7,14 @@ import (
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 	"io/ioutil"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
 
 var (
 	inProgressRegexp = regexp.MustCompile(".+_IN_PROGRESS$")
+	rollbackRegexp   = regexp.MustCompile(".*ROLLBACK_IN_PROGRESS$")
 )
 
 type cloudFormationHelper struct {
@@ -57,6 +59,23 @@ func (c cloudFormationHelper) StackExists(name string) (bool, error) {
 	return found, err
 }
 
+// DescribeStack returns the stack with the given name or ID
+func (c cloudFormationHelper) DescribeStack(name string) (*cloudformation.Stack, error) {
+	resp, err := c.svc.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(name),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Stacks) != 1 {
+		return nil, fmt.Errorf("Expected a single stack named %s, but found %d", name, len(resp.Stacks))
+	}
+
+	return resp.Stacks[0], nil
+}
+
 func (c cloudFormationHelper) ValidateTemplates(files []string) error {
 	var (
 		errors []error
@@ -110,95 +129,162 @@ func (c cloudFormationHelper) ValidateTemplate(file string) error {
 	return err
 }
 
-func (c cloudFormationHelper) WaitForStack(stackID, desiredState string) error {
-	params := &cloudformation.DescribeStacksInput{
-		StackName: aws.String(stackID),
+// WaitForChangeSet waits for a change set to be created. It returns false if
+// the change set failed because it contains no changes.
+func (c cloudFormationHelper) WaitForChangeSet(changeSetID string) (bool, error) {
+	params := &cloudformation.DescribeChangeSetInput{
+		ChangeSetName: aws.String(changeSetID),
 	}
 
-	start := time.Now().UTC()
-	timeout := time.Second * 60 * 20
-
 	for {
-		resp, err := c.svc.DescribeStacks(params)
+		resp, err := c.svc.DescribeChangeSet(params)
 
 		if err != nil {
-			return err
+			return false, err
 		}
 
-		if len(resp.Stacks) == 0 {
-			return fmt.Errorf("Stack with ID %s not found", stackID)
-		}
+		switch aws.StringValue(resp.Status) {
+		case cloudformation.ChangeSetStatusCreateComplete:
+			return true, nil
+		case cloudformation.ChangeSetStatusCreatePending, cloudformation.ChangeSetStatusCreateInProgress:
+			time.Sleep(time.Second * 5)
+		default:
+			reason := aws.StringValue(resp.StatusReason)
 
-		if len(resp.Stacks) != 1 {
-			return fmt.Errorf("Ambiguous stack ID %s", stackID)
+			if strings.Contains(reason, "didn't contain changes") || strings.Contains(reason, "No updates are to be performed") {
+				return false, nil
+			}
+
+			return false, fmt.Errorf("Change set %s failed: %s", changeSetID, reason)
 		}
+	}
+}
+
+// ChangeSetChanges returns all resource changes in a change set, including
+// those in the change sets of nested stacks. Paths of the changes are
+// prefixed with pathPrefix.
+func (c cloudFormationHelper) ChangeSetChanges(changeSetID, pathPrefix string) ([]*ResourceChange, error) {
+	var changes []*ResourceChange
+
+	params := &cloudformation.DescribeChangeSetInput{
+		ChangeSetName: aws.String(changeSetID),
+	}
 
-		status := *resp.Stacks[0].StackStatus
+	for {
+		resp, err := c.svc.DescribeChangeSet(params)
 
-		if status == desiredState {
-			return nil
+		if err != nil {
+			return nil, err
 		}
 
-		if !inProgressRegexp.MatchString(status) {
-			return fmt.Errorf("Unexpected stack status. Wanted %s, but got %s", desiredState, status)
+		for _, change := range resp.Changes {
+			rc := change.ResourceChange
+
+			if rc == nil {
+				continue
+			}
+
+			path := pathPrefix + aws.StringValue(rc.LogicalResourceId)
+
+			changes = append(changes, &ResourceChange{
+				ResourceChange: rc,
+				Path:           path,
+			})
+
+			if aws.StringValue(rc.ResourceType) == "AWS::CloudFormation::Stack" && rc.ChangeSetId != nil {
+				nested, err := c.ChangeSetChanges(*rc.ChangeSetId, path+".")
+
+				if err != nil {
+					return nil, err
+				}
+
+				changes = append(changes, nested...)
+			}
 		}
 
-		if time.Since(start) > timeout {
-			return fmt.Errorf("Stack %s failed to reach state %s within %s", stackID, desiredState, timeout)
+		if resp.NextToken == nil {
+			return changes, nil
 		}
 
-		time.Sleep(time.Second * 5)
+		params.NextToken = resp.NextToken
 	}
 }
 
-func (c cloudFormationHelper) LogStackEvents(stackID string, logger func(*cloudformation.StackEvent, error)) (cancel func()) {
-	done := make(chan struct{})
-	ticker := time.NewTicker(time.Second * 5)
+// EventsSince returns the events of a stack, from newest to oldest, up to and
+// including the most recent event for which start returns true. If no such
+// event is found, all events are returned.
+func (c cloudFormationHelper) EventsSince(stackID string, start func(*cloudformation.StackEvent) bool) ([]*cloudformation.StackEvent, error) {
+	var events []*cloudformation.StackEvent
 
 	params := &cloudformation.DescribeStackEventsInput{
 		StackName: aws.String(stackID),
 	}
 
-	go func() {
-		defer ticker.Stop()
-		var lastEventID string
+	err := c.svc.DescribeStackEventsPages(params, func(page *cloudformation.DescribeStackEventsOutput, lastPage bool) bool {
+		for _, e := range page.StackEvents {
+			events = append(events, e)
 
-		for {
-			resp, err := c.svc.DescribeStackEvents(params)
+			if start(e) {
+				return false
+			}
+		}
+		return true
+	})
 
-			if err != nil {
-				logger(nil, err)
-			} else {
-				if len(resp.StackEvents) > 0 {
-					newEvents := resp.StackEvents[:1]
-
-					if lastEventID != "" {
-						newEvents = resp.StackEvents
-
-						for i, event := range resp.StackEvents {
-							if *event.EventId == lastEventID {
-								newEvents = resp.StackEvents[:i]
-								break
-							}
-						}
-					}
-
-					for i := len(newEvents) - 1; i >= 0; i-- {
-						logger(newEvents[i], nil)
-						lastEventID = *newEvents[i].EventId
-					}
+	return events, err
+}
+
+// OperationEvents returns the events of a stack, from newest to oldest, of the
+// operation that was started with token
+func (c cloudFormationHelper) OperationEvents(stackID, token string) ([]*cloudformation.StackEvent, error) {
+	var events []*cloudformation.StackEvent
+
+	params := &cloudformation.DescribeStackEventsInput{
+		StackName: aws.String(stackID),
+	}
+
+	err := c.svc.DescribeStackEventsPages(params, func(page *cloudformation.DescribeStackEventsOutput, lastPage bool) bool {
+		for _, e := range page.StackEvents {
+			if aws.StringValue(e.ClientRequestToken) != token {
+				// the events of an operation follow each other, so the
+				// operation ends at the first older event without the token
+				if len(events) > 0 {
+					return false
 				}
+				continue
 			}
 
-			select {
-			case <-done:
-				return
-			case <-ticker.C:
-			}
+			events = append(events, e)
 		}
-	}()
+		return true
+	})
+
+	return events, err
+}
+
+// isBusy returns true if an operation is in progress on a stack with the
+// given status. A stack that is waiting for a change set to be executed is
+// not busy, as it will not change until the change set is executed.
+func isBusy(status string) bool {
+	return inProgressRegexp.MatchString(status) && status != cloudformation.StackStatusReviewInProgress
+}
 
-	return func() {
-		close(done)
+// resourcesComplete returns true if none of the resources of the stack are
+// still being created or updated
+func (c cloudFormationHelper) resourcesComplete(stackID string) (bool, error) {
+	resp, err := c.svc.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
+		StackName: aws.String(stackID),
+	})
+
+	if err != nil {
+		return false, err
 	}
+
+	for _, r := range resp.StackResources {
+		if inProgressRegexp.MatchString(aws.StringValue(r.ResourceStatus)) {
+			return false, nil
+		}
+	}
+
+	return len(resp.StackResources) > 0, nil
 }
@@ -0,0 +1,269 @@
+package deployer
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultProtectedResourceTypes are the resource types that may not be
+	// removed or replaced unless explicitly allowed
+	DefaultProtectedResourceTypes = []string{
+		"AWS::RDS::DBInstance",
+		"AWS::DynamoDB::Table",
+		"AWS::S3::Bucket",
+		"AWS::EFS::FileSystem",
+	}
+)
+
+// Preview describes the changes a deployment will make to a stack
+type Preview struct {
+	StackName  string
+	Exists     bool
+	Changes    []*ResourceChange
+	Parameters []ParameterChange
+}
+
+// ParameterChange is a change to the value of a stack parameter
+type ParameterChange struct {
+	Key     string
+	Current string
+	Desired string
+}
+
+// ResourceChange is a change to a resource in a stack or one of its nested
+// stacks
+type ResourceChange struct {
+	*cloudformation.ResourceChange
+
+	// Path is the logical ID of the resource, prefixed by the logical IDs of
+	// the nested stacks that contain it, separated by dots
+	Path string
+}
+
+// IsDestructive returns true if the change removes the resource, or may
+// replace it with a new resource
+func (r *ResourceChange) IsDestructive() bool {
+	switch aws.StringValue(r.Action) {
+	case cloudformation.ChangeActionRemove:
+		return true
+	case cloudformation.ChangeActionModify:
+		replacement := aws.StringValue(r.Replacement)
+		return replacement == cloudformation.ReplacementTrue || replacement == cloudformation.ReplacementConditional
+	}
+	return false
+}
+
+// changeSet is a change set that is inspected before it is executed
+type changeSet struct {
+	id      string
+	stackID string
+	changes []*ResourceChange
+}
+
+// createChangeSet creates a change set of the given type, that creates or
+// updates the stack, waits for it to be created, and reads the resource
+// changes it contains. If the change set contains no changes it is deleted,
+// and errNoChanges is returned.
+func (d *deployer) createChangeSet(options *DeployOptions, templateURL string, params StackParams, changeSetType string) (*changeSet, error) {
+	log.Printf("Creating change set")
+
+	resp, err := d.svc.CreateChangeSet(d.buildCreateChangeSetInput(options, templateURL, params, changeSetType))
+
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &changeSet{
+		id:      aws.StringValue(resp.Id),
+		stackID: aws.StringValue(resp.StackId),
+	}
+
+	ok, err := d.helper.WaitForChangeSet(cs.id)
+
+	if err == nil && !ok {
+		err = errNoChanges
+	}
+
+	if err == nil {
+		cs.changes, err = d.helper.ChangeSetChanges(cs.id, "")
+	}
+
+	if err != nil {
+		d.discardChangeSet(cs, changeSetType)
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// executeChangeSet executes a change set that was inspected, and returns the
+// ID of its stack
+func (d *deployer) executeChangeSet(cs *changeSet, options *DeployOptions) (string, error) {
+	log.Printf("Executing change set")
+
+	params := &cloudformation.ExecuteChangeSetInput{
+		ChangeSetName: aws.String(cs.id),
+	}
+
+	if options.ClientRequestToken != "" {
+		params.ClientRequestToken = aws.String(options.ClientRequestToken)
+	}
+
+	if _, err := d.svc.ExecuteChangeSet(params); err != nil {
+		return "", err
+	}
+
+	return cs.stackID, nil
+}
+
+// discardChangeSet deletes a change set that will not be executed. A change
+// set that creates a stack leaves the stack in REVIEW_IN_PROGRESS, so the
+// stack is deleted too.
+func (d *deployer) discardChangeSet(cs *changeSet, changeSetType string) {
+	if _, err := d.svc.DeleteChangeSet(&cloudformation.DeleteChangeSetInput{ChangeSetName: aws.String(cs.id)}); err != nil {
+		log.Printf("Unable to delete change set %s: %s", cs.id, err.Error())
+	}
+
+	if changeSetType != cloudformation.ChangeSetTypeCreate {
+		return
+	}
+
+	if _, err := d.svc.DeleteStack(&cloudformation.DeleteStackInput{StackName: aws.String(cs.stackID)}); err != nil {
+		log.Printf("Unable to delete stack %s, which was never created: %s", cs.stackID, err.Error())
+	}
+}
+
+// buildCreateChangeSetInput builds up the CreateChangeSetInput struct for a
+// change set of the given type
+func (d *deployer) buildCreateChangeSetInput(options *DeployOptions, templateURL string, params StackParams, changeSetType string) *cloudformation.CreateChangeSetInput {
+	createChangeSetInput := &cloudformation.CreateChangeSetInput{
+		ChangeSetName:       aws.String(fmt.Sprintf("cfndeploy-%d", time.Now().Unix())),
+		ChangeSetType:       aws.String(changeSetType),
+		StackName:           aws.String(options.StackName),
+		Parameters:          params.AWSParams(),
+		Tags:                options.StackTags.AWSTags(),
+		TemplateURL:         aws.String(templateURL),
+		IncludeNestedStacks: aws.Bool(true),
+		Capabilities: []*string{
+			aws.String(cloudformation.CapabilityCapabilityIam),
+		},
+	}
+
+	if options.ServiceRoleARN != "" {
+		createChangeSetInput.RoleARN = aws.String(options.ServiceRoleARN)
+	}
+
+	if options.NotificationARNs != nil {
+		createChangeSetInput.NotificationARNs = aws.StringSlice(options.NotificationARNs)
+	}
+
+	if options.RollbackConfiguration != nil {
+		createChangeSetInput.RollbackConfiguration = options.RollbackConfiguration.AWSRollbackConfiguration()
+	}
+
+	if changeSetType == cloudformation.ChangeSetTypeCreate {
+		if options.OnFailure != "" {
+			createChangeSetInput.OnStackFailure = aws.String(options.OnFailure)
+		} else if options.DisableRollback {
+			createChangeSetInput.OnStackFailure = aws.String(cloudformation.OnStackFailureDoNothing)
+		}
+	}
+
+	return createChangeSetInput
+}
+
+// diffParameters returns the changes from the current parameters of a stack
+// to the desired parameters, sorted by key
+func diffParameters(current []*cloudformation.Parameter, desired StackParams) []ParameterChange {
+	values := make(map[string]string)
+
+	for _, p := range current {
+		values[aws.StringValue(p.ParameterKey)] = aws.StringValue(p.ParameterValue)
+	}
+
+	var changes []ParameterChange
+
+	for key, value := range desired {
+		if currentValue, ok := values[key]; !ok || currentValue != value {
+			changes = append(changes, ParameterChange{Key: key, Current: currentValue, Desired: value})
+		}
+	}
+
+	for key, value := range values {
+		if _, ok := desired[key]; !ok {
+			changes = append(changes, ParameterChange{Key: key, Current: value})
+		}
+	}
+
+	sort.Sort(byKey(changes))
+
+	return changes
+}
+
+// findDestructiveChanges returns the changes that remove or replace a
+// resource of one of the protected types, and that are not explicitly
+// allowed by their logical ID or path
+func findDestructiveChanges(changes []*ResourceChange, protectedTypes, allowReplace []string) []*ResourceChange {
+	var destructive []*ResourceChange
+
+	for _, change := range changes {
+		if !change.IsDestructive() || !contains(protectedTypes, aws.StringValue(change.ResourceType)) {
+			continue
+		}
+
+		if contains(allowReplace, aws.StringValue(change.LogicalResourceId)) || contains(allowReplace, change.Path) {
+			continue
+		}
+
+		destructive = append(destructive, change)
+	}
+
+	return destructive
+}
+
+// destructiveChangesError builds an error describing the blocked changes
+func destructiveChangesError(changes []*ResourceChange) error {
+	var lines []string
+
+	for _, change := range changes {
+		action := aws.StringValue(change.Action)
+
+		if action == cloudformation.ChangeActionModify {
+			action = fmt.Sprintf("Replace (%s)", aws.StringValue(change.Replacement))
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s %s (%s)", action, change.Path, aws.StringValue(change.ResourceType)))
+	}
+
+	return fmt.Errorf("Deployment would remove or replace protected resources:\n%s\nAllow each resource with allow-replace, or allow all with allow-destructive", strings.Join(lines, "\n"))
+}
+
+// contains returns true if values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// byPath sorts resource changes by path
+type byPath []*ResourceChange
+
+func (s byPath) Len() int           { return len(s) }
+func (s byPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPath) Less(i, j int) bool { return s[i].Path < s[j].Path }
+
+// byKey sorts parameter changes by key
+type byKey []ParameterChange
+
+func (s byKey) Len() int           { return len(s) }
+func (s byKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byKey) Less(i, j int) bool { return s[i].Key < s[j].Key }
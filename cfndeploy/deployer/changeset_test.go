@@ -0,0 +1,274 @@
+package deployer
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/bernos/cfn-deploy/cfndeploy/history"
+	"testing"
+)
+
+func testResourceChange(path, logicalID, resourceType, action, replacement string) *ResourceChange {
+	return &ResourceChange{
+		Path: path,
+		ResourceChange: &cloudformation.ResourceChange{
+			LogicalResourceId: aws.String(logicalID),
+			ResourceType:      aws.String(resourceType),
+			Action:            aws.String(action),
+			Replacement:       aws.String(replacement),
+		},
+	}
+}
+
+func TestFindDestructiveChanges(t *testing.T) {
+	changes := []*ResourceChange{
+		testResourceChange("Database", "Database", "AWS::RDS::DBInstance", "Modify", "True"),
+		testResourceChange("Table", "Table", "AWS::DynamoDB::Table", "Modify", "False"),
+		testResourceChange("Bucket", "Bucket", "AWS::S3::Bucket", "Remove", ""),
+		testResourceChange("Data.Files", "Files", "AWS::EFS::FileSystem", "Modify", "Conditional"),
+		testResourceChange("WebLoadBalancer", "WebLoadBalancer", "AWS::ElasticLoadBalancing::LoadBalancer", "Remove", ""),
+		testResourceChange("Queue", "Queue", "AWS::SQS::Queue", "Add", ""),
+	}
+
+	tests := []struct {
+		allowReplace []string
+		want         []string
+	}{
+		{nil, []string{"Database", "Bucket", "Data.Files"}},
+		{[]string{"Database", "Files"}, []string{"Bucket"}},
+		{[]string{"Data.Files", "Bucket"}, []string{"Database"}},
+	}
+
+	for _, tt := range tests {
+		got := findDestructiveChanges(changes, DefaultProtectedResourceTypes, tt.allowReplace)
+
+		if len(got) != len(tt.want) {
+			t.Errorf("Incorrect length. Want %d, got %d", len(tt.want), len(got))
+			continue
+		}
+
+		for i := range got {
+			if got[i].Path != tt.want[i] {
+				t.Errorf("Want %s, got %s", tt.want[i], got[i].Path)
+			}
+		}
+	}
+}
+
+func TestDiffParameters(t *testing.T) {
+	current := []*cloudformation.Parameter{
+		{ParameterKey: aws.String("Version"), ParameterValue: aws.String("1234abcd")},
+		{ParameterKey: aws.String("InstanceType"), ParameterValue: aws.String("t2.micro")},
+		{ParameterKey: aws.String("Removed"), ParameterValue: aws.String("gone")},
+	}
+
+	desired := StackParams{
+		"Version":      "5678ef01",
+		"InstanceType": "t2.micro",
+		"Added":        "new",
+	}
+
+	want := []ParameterChange{
+		{Key: "Added", Current: "", Desired: "new"},
+		{Key: "Removed", Current: "gone", Desired: ""},
+		{Key: "Version", Current: "1234abcd", Desired: "5678ef01"},
+	}
+
+	got := diffParameters(current, desired)
+
+	if len(got) != len(want) {
+		t.Fatalf("Incorrect length. Want %d, got %d", len(want), len(got))
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("Want %v, got %v", want[i], got[i])
+		}
+	}
+}
+
+// changeSetAPI creates change sets with canned changes, and records which
+// change sets are executed and deleted
+type changeSetAPI struct {
+	cloudformationiface.CloudFormationAPI
+	status   string
+	reason   string
+	changes  []*cloudformation.Change
+	executed []*cloudformation.ExecuteChangeSetInput
+	deleted  []string
+	updated  bool
+
+	changeSetType string
+	deletedStacks []string
+}
+
+func (api *changeSetAPI) CreateChangeSet(input *cloudformation.CreateChangeSetInput) (*cloudformation.CreateChangeSetOutput, error) {
+	api.changeSetType = aws.StringValue(input.ChangeSetType)
+	return &cloudformation.CreateChangeSetOutput{Id: aws.String("changeset"), StackId: aws.String("stack-id")}, nil
+}
+
+func (api *changeSetAPI) DescribeChangeSet(input *cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error) {
+	return &cloudformation.DescribeChangeSetOutput{
+		Status:       aws.String(api.status),
+		StatusReason: aws.String(api.reason),
+		Changes:      api.changes,
+	}, nil
+}
+
+func (api *changeSetAPI) ExecuteChangeSet(input *cloudformation.ExecuteChangeSetInput) (*cloudformation.ExecuteChangeSetOutput, error) {
+	api.executed = append(api.executed, input)
+	return &cloudformation.ExecuteChangeSetOutput{}, nil
+}
+
+func (api *changeSetAPI) DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error) {
+	api.deleted = append(api.deleted, aws.StringValue(input.ChangeSetName))
+	return &cloudformation.DeleteChangeSetOutput{}, nil
+}
+
+func (api *changeSetAPI) DeleteStack(input *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error) {
+	api.deletedStacks = append(api.deletedStacks, aws.StringValue(input.StackName))
+	return &cloudformation.DeleteStackOutput{}, nil
+}
+
+func (api *changeSetAPI) UpdateStack(input *cloudformation.UpdateStackInput) (*cloudformation.UpdateStackOutput, error) {
+	api.updated = true
+	return &cloudformation.UpdateStackOutput{StackId: aws.String("stack-id")}, nil
+}
+
+func TestUpdateExecutesReviewedChangeSet(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       string
+		reason       string
+		approve      bool
+		wantErr      error
+		wantExecuted bool
+		wantDeleted  bool
+	}{
+		{"approved", cloudformation.ChangeSetStatusCreateComplete, "", true, nil, true, false},
+		{"declined", cloudformation.ChangeSetStatusCreateComplete, "", false, ErrNotApproved, false, true},
+		{"no changes", cloudformation.ChangeSetStatusFailed, "The submitted information didn't contain changes.", true, errNoChanges, false, true},
+	}
+
+	for _, tt := range tests {
+		api := &changeSetAPI{
+			status: tt.status,
+			reason: tt.reason,
+			changes: []*cloudformation.Change{{ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String(cloudformation.ChangeActionAdd),
+				LogicalResourceId: aws.String("Queue"),
+				ResourceType:      aws.String("AWS::SQS::Queue"),
+			}}},
+		}
+
+		d := &deployer{svc: api, helper: &cloudFormationHelper{api}}
+
+		var reviewed *Preview
+
+		options := &DeployOptions{
+			StackName:          "stack",
+			ClientRequestToken: "token",
+			Approve: func(p *Preview) (bool, error) {
+				reviewed = p
+				return tt.approve, nil
+			},
+		}
+
+		stackID, _, err := d.update(&cloudformation.Stack{}, options, "https://example.com/Stack.json", StackParams{}, nil)
+
+		if err != tt.wantErr {
+			t.Errorf("%s: want error %v, got %v", tt.name, tt.wantErr, err)
+		}
+
+		if api.updated {
+			t.Errorf("%s: want the change set to be used, got UpdateStack", tt.name)
+		}
+
+		if executed := len(api.executed) > 0; executed != tt.wantExecuted {
+			t.Errorf("%s: want executed %t, got %t", tt.name, tt.wantExecuted, executed)
+		}
+
+		if deleted := len(api.deleted) > 0; deleted != tt.wantDeleted {
+			t.Errorf("%s: want deleted %t, got %t", tt.name, tt.wantDeleted, deleted)
+		}
+
+		if !tt.wantExecuted {
+			continue
+		}
+
+		if stackID != "stack-id" || aws.StringValue(api.executed[0].ClientRequestToken) != "token" {
+			t.Errorf("%s: want stack-id executed with token, got %s %v", tt.name, stackID, api.executed[0])
+		}
+
+		if reviewed == nil || len(reviewed.Changes) != 1 || reviewed.Changes[0].Path != "Queue" {
+			t.Errorf("%s: want the changes of the change set reviewed, got %v", tt.name, reviewed)
+		}
+	}
+}
+
+func TestCreateReviewsChangeSet(t *testing.T) {
+	tests := []struct {
+		name         string
+		approve      bool
+		wantErr      error
+		wantExecuted bool
+		wantDeleted  bool
+	}{
+		{"approved", true, nil, true, false},
+		{"declined", false, ErrNotApproved, false, true},
+	}
+
+	for _, tt := range tests {
+		api := &changeSetAPI{
+			status: cloudformation.ChangeSetStatusCreateComplete,
+			changes: []*cloudformation.Change{{ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String(cloudformation.ChangeActionAdd),
+				LogicalResourceId: aws.String("Queue"),
+				ResourceType:      aws.String("AWS::SQS::Queue"),
+			}}},
+		}
+
+		d := &deployer{svc: api, helper: &cloudFormationHelper{api}}
+
+		var reviewed *Preview
+
+		options := &DeployOptions{
+			StackName: "stack",
+			Approve: func(p *Preview) (bool, error) {
+				reviewed = p
+				return tt.approve, nil
+			},
+		}
+
+		params := StackParams{"Password": "secret"}
+		stackID, finish, err := d.create(options, "https://example.com/Stack.json", params, map[string]bool{"Password": true})
+
+		if err != tt.wantErr {
+			t.Errorf("%s: want error %v, got %v", tt.name, tt.wantErr, err)
+		}
+
+		if api.changeSetType != cloudformation.ChangeSetTypeCreate {
+			t.Errorf("%s: want change set type %s, got %s", tt.name, cloudformation.ChangeSetTypeCreate, api.changeSetType)
+		}
+
+		if executed := len(api.executed) > 0; executed != tt.wantExecuted {
+			t.Errorf("%s: want executed %t, got %t", tt.name, tt.wantExecuted, executed)
+		}
+
+		if deleted := len(api.deleted) > 0 && len(api.deletedStacks) > 0; deleted != tt.wantDeleted {
+			t.Errorf("%s: want change set and stack deleted %t, got %t", tt.name, tt.wantDeleted, deleted)
+		}
+
+		if reviewed == nil || len(reviewed.Changes) != 1 || reviewed.Changes[0].Path != "Queue" {
+			t.Errorf("%s: want the changes of the change set reviewed, got %v", tt.name, reviewed)
+		}
+
+		if reviewed != nil && (len(reviewed.Parameters) != 1 || reviewed.Parameters[0].Desired != history.MaskedValue) {
+			t.Errorf("%s: want the NoEcho parameter masked, got %v", tt.name, reviewed.Parameters)
+		}
+
+		if tt.wantExecuted && (stackID != "stack-id" || finish == nil) {
+			t.Errorf("%s: want stack-id and a finish function, got %s", tt.name, stackID)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package deployer
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"log"
+	"time"
+)
+
+// Delete deletes a stack and waits for the deletion to complete, writing the
+// events of the stack and its nested stacks to the formatter
+func (d *deployer) Delete(options *DeleteOptions) error {
+	stack, err := d.helper.DescribeStack(options.StackName)
+
+	if err != nil {
+		return err
+	}
+
+	if status := aws.StringValue(stack.StackStatus); isBusy(status) {
+		return fmt.Errorf("Stack %s is %s. Wait for the operation to finish before deleting the stack", options.StackName, status)
+	}
+
+	params := &cloudformation.DeleteStackInput{
+		StackName:          stack.StackId,
+		ClientRequestToken: aws.String(clientRequestToken("delete", time.Now())),
+	}
+
+	if len(options.RetainResources) > 0 {
+		params.RetainResources = aws.StringSlice(options.RetainResources)
+	}
+
+	if options.ServiceRoleARN != "" {
+		params.RoleARN = aws.String(options.ServiceRoleARN)
+	}
+
+	log.Printf("Deleting stack %s", options.StackName)
+
+	if _, err := d.svc.DeleteStack(params); err != nil {
+		return err
+	}
+
+	return d.waitForOperation(aws.StringValue(stack.StackId), aws.StringValue(params.ClientRequestToken), cloudformation.StackStatusDeleteComplete, nil, operationTimeout)
+}
+
+// Events writes the events of the most recent operation on a stack, including
+// those of its nested stacks, to the formatter. If Follow is set, events are
+// written until the operation finishes.
+func (d *deployer) Events(options *EventsOptions) error {
+	stack, err := d.helper.DescribeStack(options.StackName)
+
+	if err != nil {
+		return err
+	}
+
+	stackID := aws.StringValue(stack.StackId)
+
+	if options.Follow {
+		_, err := d.watchOperation(stackID, "", nil, options.Timeout)
+		return err
+	}
+
+	evts, err := newEventStream(d.helper, stackID, "").poll()
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range evts {
+		if err := d.f.Write(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
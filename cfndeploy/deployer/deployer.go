@@ -2,10 +2,14 @@ package deployer
 
 import (
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"github.com/bernos/cfn-deploy/cfndeploy/history"
+	"github.com/bernos/cfn-deploy/cfndeploy/lock"
 	"github.com/bernos/cfn-deploy/cfndeploy/uploader"
 	"io/ioutil"
 	"log"
@@ -13,11 +17,35 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+var (
+	// ErrNotApproved means that the changes to a stack were not approved, so
+	// the deployment was cancelled
+	ErrNotApproved = errors.New("Deployment was not approved")
+
+	// errNoChanges means that a deployment would not change the stack
+	errNoChanges = errors.New("No changes to deploy")
+)
+
+// allowAllStackPolicy allows all updates, which is the same as having no stack
+// policy
+const allowAllStackPolicy = `{"Statement":[{"Effect":"Allow","Action":"Update:*","Principal":"*","Resource":"*"}]}`
+
 // Deployer is and interface that can deploy a cloudformation stack
 type Deployer interface {
 	Deploy(*DeployOptions) error
+	Plan(*DeployOptions) (*Plan, error)
+	StackPolicy(stackName string) (string, error)
+	SetStackPolicy(stackName, policy string) error
+	RollbackFailures(stackName string) ([]*RollbackFailure, error)
+	ContinueUpdateRollback(*ContinueUpdateRollbackOptions) error
+	Delete(*DeleteOptions) error
+	Events(*EventsOptions) error
+	Drift(stackName string) ([]*ResourceDrift, error)
+	Diff(*DeployOptions) (*Diff, error)
+	Pull(*PullOptions) (*PulledStack, error)
 }
 
 // deployer implements the Deployer interface
@@ -25,20 +53,35 @@ type deployer struct {
 	svc    cloudformationiface.CloudFormationAPI
 	helper *cloudFormationHelper
 	u      uploader.Uploader
+	l      lock.Locker
+	h      history.Store
+	f      events.Formatter
 }
 
-// New creates a new Deployer instance
-func New(c cloudformationiface.CloudFormationAPI, u uploader.Uploader) Deployer {
+// New creates a new Deployer instance. The locker is only required when
+// deploying with the Lock option, and deployments are only recorded in the
+// history if a history store is given. Stack events are written to the
+// formatter, or as text to stderr if it is nil.
+func New(c cloudformationiface.CloudFormationAPI, u uploader.Uploader, l lock.Locker, h history.Store, f events.Formatter) Deployer {
+	if f == nil {
+		f, _ = events.New(events.TextOutput, os.Stderr, false)
+	}
+
 	return &deployer{
 		svc:    c,
 		u:      u,
+		l:      l,
+		h:      h,
+		f:      f,
 		helper: &cloudFormationHelper{c},
 	}
 }
 
 // Deploy detploys a cloudformation stack. If the stack does not exist it will
-// be created, otherwise the existing stack will be updated.
-func (d *deployer) Deploy(options *DeployOptions) error {
+// be created, otherwise the existing stack will be updated. Once the templates
+// are uploaded, the deployment is recorded in the history of the stack.
+func (d *deployer) Deploy(options *DeployOptions) (err error) {
+	start := time.Now()
 	mainTemplate := path.Join(options.TemplateFolder, options.MainTemplate)
 
 	if options.StackParams == nil {
@@ -49,6 +92,16 @@ func (d *deployer) Deploy(options *DeployOptions) error {
 		options.StackTags = StackTags(make(map[string]string))
 	}
 
+	if options.Lock {
+		release, err := d.acquireLock(options)
+
+		if err != nil {
+			return err
+		}
+
+		defer release()
+	}
+
 	log.Printf("Checking if stack already exists")
 	exists, err := d.helper.StackExists(options.StackName)
 
@@ -56,24 +109,36 @@ func (d *deployer) Deploy(options *DeployOptions) error {
 		return err
 	}
 
-	templates, err := findTemplates(options.TemplateFolder)
+	if exists {
+		if err := d.waitForStableStack(options); err != nil {
+			return err
+		}
+	}
+
+	b, err := newBuild(options.TemplateFolder, mainTemplate, options.TemplateVars)
 
 	if err != nil {
 		return err
 	}
 
-	version, err := checksumTemplates(templates)
+	defer b.Close()
+
+	version, bucketPrefix, err := b.packageTemplates(options)
 
 	if err != nil {
 		return err
 	}
 
-	prefix := path.Join(
-		calculateBucketPrefix(options.StackName, options.BucketFolder, version),
-		"templates")
+	if len(b.artifacts) > 0 {
+		log.Printf("Uploading artifacts")
+
+		if err := d.uploadArtifacts(b.artifacts, options.Bucket, path.Join(bucketPrefix, "artifacts")); err != nil {
+			return err
+		}
+	}
 
 	log.Printf("Uploading templates")
-	templateURL, err := d.uploadTemplates(templates, mainTemplate, options.Bucket, prefix)
+	templateURL, err := d.uploadTemplates(b.templates, b.mainTemplate, options.Bucket, path.Join(bucketPrefix, "templates"))
 
 	if err != nil {
 		return err
@@ -81,51 +146,478 @@ func (d *deployer) Deploy(options *DeployOptions) error {
 
 	params := d.buildStackParams(version, templateURL, options.StackParams)
 
+	if options.ClientRequestToken == "" {
+		options.ClientRequestToken = deploymentToken(options.StackName, version, start)
+	}
+
 	var (
 		stackID       string
 		desiredStatus string
 	)
 
+	entry, err := newHistoryEntry(options, b, version, params, start)
+
+	if err != nil {
+		return err
+	}
+
+	noEcho, err := readNoEchoParameters(b.mainTemplate)
+
+	if err != nil {
+		return err
+	}
+
+	var finish func() error
+
+	defer func() {
+		d.recordHistory(options, entry, stackID, desiredStatus, err)
+	}()
+
 	if exists {
-		stackID, err = d.update(options.StackName, templateURL, params, options.StackTags)
+		var stack *cloudformation.Stack
+
+		if stack, err = d.helper.DescribeStack(options.StackName); err != nil {
+			return err
+		}
+
+		checkServiceRole(stack, options)
+
+		var restorePolicy func()
+
+		stackID, restorePolicy, err = d.update(stack, options, templateURL, params, noEcho)
 		desiredStatus = cloudformation.StackStatusUpdateComplete
+
+		if restorePolicy != nil {
+			defer restorePolicy()
+		}
 	} else {
-		stackID, err = d.create(options.StackName, templateURL, params, options.StackTags)
+		stackID, finish, err = d.create(options, templateURL, params, noEcho)
 		desiredStatus = cloudformation.StackStatusCreateComplete
 	}
 
-	if err == nil {
-		cancel := d.helper.LogStackEvents(stackID, func(e *cloudformation.StackEvent, err error) {
-			log.Printf("%v", e)
-		})
-		err = d.helper.WaitForStack(stackID, desiredStatus)
-		cancel()
+	if err == errNoChanges {
+		log.Printf("Stack %s is up to date, there are no changes to deploy", options.StackName)
+		desiredStatus = history.StatusNoChanges
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = d.waitForOperation(stackID, options.ClientRequestToken, desiredStatus, options.RollbackConfiguration, deployTimeout(options)); err != nil {
+		return err
+	}
+
+	if finish != nil {
+		return finish()
+	}
+
+	return nil
+}
+
+// acquireLock takes the deployment lock of the stack, and returns a function
+// that releases it
+func (d *deployer) acquireLock(options *DeployOptions) (release func(), err error) {
+	if d.l == nil {
+		return nil, fmt.Errorf("Unable to lock stack %s, no locker configured", options.StackName)
+	}
+
+	key := lock.Key(options.StackName, options.BucketFolder)
+
+	log.Printf("Acquiring lock s3://%s/%s", options.Bucket, key)
+	l, err := d.l.Acquire(options.Bucket, key, options.LockOwner, options.LockTTL, options.LockTimeout)
+
+	if err != nil {
+		return nil, err
 	}
 
+	return func() {
+		log.Printf("Releasing lock s3://%s/%s", options.Bucket, key)
+
+		if err := d.l.Release(options.Bucket, key, l); err != nil {
+			log.Printf("Unable to release lock: %s", err.Error())
+		}
+	}, nil
+}
+
+// watchOperation writes the events of the operation on a stack that was
+// started with token, including those of its nested stacks, to the formatter
+// until the operation finishes, and returns the final status of the stack. If
+// token is empty the most recent operation is watched. If rollback triggers
+// are configured it reports when the stack enters the monitoring window, and
+// when an alarm triggers a rollback.
+func (d *deployer) watchOperation(stackID, token string, rollback *RollbackConfiguration, timeout time.Duration) (string, error) {
+	w := d.helper.newWatcher(stackID, token)
+	sub := w.Subscribe()
+
+	var (
+		status string
+		err    error
+		done   = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+		status, err = w.Run(nil, timeout)
+	}()
+
+	m := &rollbackMonitor{rollback: rollback, stackID: stackID, resourcesComplete: d.helper.resourcesComplete}
+
+	for evts, statuses := sub.Events, sub.Statuses; evts != nil || statuses != nil; {
+		select {
+		case e, ok := <-evts:
+			if !ok {
+				evts = nil
+				continue
+			}
+
+			if err := d.f.Write(e); err != nil {
+				log.Printf("Unable to write stack event: %s", err.Error())
+			}
+
+			m.event(e)
+
+		case change, ok := <-statuses:
+			if !ok {
+				statuses = nil
+				continue
+			}
+
+			m.statusChange(stackID, change)
+		}
+	}
+
+	<-done
+
+	return status, err
+}
+
+// rollbackMonitor reports the progress of an operation with rollback triggers
+type rollbackMonitor struct {
+	rollback          *RollbackConfiguration
+	stackID           string
+	status            string
+	monitoring        bool
+	resourcesComplete func(stackID string) (bool, error)
+}
+
+// event reports when the stack enters the monitoring window. Events only
+// show the resources that changed so far, so when a resource of the stack
+// completes, the resources of the stack are described to check that all of
+// them are complete.
+func (m *rollbackMonitor) event(e *events.Event) {
+	if e.Path != "" || events.IsStackEvent(e.StackEvent) || inProgressRegexp.MatchString(aws.StringValue(e.ResourceStatus)) {
+		return
+	}
+
+	if m.monitoring || !m.rollback.hasTriggers() || rollbackRegexp.MatchString(m.status) {
+		return
+	}
+
+	complete, err := m.resourcesComplete(m.stackID)
+
+	if err != nil {
+		log.Printf("Unable to describe stack resources: %s", err.Error())
+		return
+	}
+
+	if !complete {
+		return
+	}
+
+	m.monitoring = true
+	log.Printf("Stack %s entered the rollback monitoring window. Watching %d alarms for %s", aws.StringValue(e.StackName), len(m.rollback.AlarmARNs), m.rollback.MonitoringPeriod)
+}
+
+// statusChange reports when the stack starts to roll back, and which alarm
+// triggered the rollback if it was one of the rollback triggers
+func (m *rollbackMonitor) statusChange(stackID string, change *StatusChange) {
+	m.status = change.Status
+
+	if !rollbackRegexp.MatchString(change.Status) || strings.HasPrefix(change.Status, "UPDATE_ROLLBACK_COMPLETE") {
+		return
+	}
+
+	if m.rollback != nil {
+		for _, arn := range m.rollback.AlarmARNs {
+			if strings.Contains(change.Reason, arn) || strings.Contains(change.Reason, alarmName(arn)) {
+				log.Printf("Alarm %s triggered a rollback of stack %s: %s", arn, stackID, change.Reason)
+				return
+			}
+		}
+	}
+
+	log.Printf("Stack %s is rolling back: %s", stackID, change.Reason)
+}
+
+// alarmName returns the name part of a cloudwatch alarm ARN
+func alarmName(arn string) string {
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
+
+// deployTimeout returns the maximum time to wait for a deployment, not
+// counting any rollback monitoring period. It is the timeout of the stack
+// operation given in options, if that is longer than operationTimeout.
+func deployTimeout(options *DeployOptions) time.Duration {
+	if timeout := time.Duration(options.TimeoutInMinutes) * time.Minute; timeout > operationTimeout {
+		return timeout
+	}
+	return operationTimeout
+}
+
+// waitForOperation watches the operation on a stack that was started with
+// token for up to timeout, plus the monitoring period of any rollback
+// triggers, and returns an error naming the resources that failed if the
+// stack does not reach desiredStatus
+func (d *deployer) waitForOperation(stackID, token, desiredStatus string, rollback *RollbackConfiguration, timeout time.Duration) error {
+	if rollback != nil {
+		timeout += rollback.MonitoringPeriod
+	}
+
+	status, err := d.watchOperation(stackID, token, rollback, timeout)
+
+	if err == nil && status != desiredStatus {
+		err = fmt.Errorf("Unexpected stack status. Wanted %s, but got %s", desiredStatus, status)
+	}
+
+	if err != nil {
+		return d.failedOperationError(stackID, token, err)
+	}
+
+	return nil
+}
+
+// waitForStableStack waits for any operation that is in progress on the stack
+// to finish, logging its events. It returns an error if the operation does
+// not finish within the wait timeout, or if it leaves the stack in a state
+// that cannot be updated.
+func (d *deployer) waitForStableStack(options *DeployOptions) error {
+	stack, err := d.helper.DescribeStack(options.StackName)
+
+	if err != nil {
+		return err
+	}
+
+	status := aws.StringValue(stack.StackStatus)
+
+	if isBusy(status) {
+		log.Printf("Stack %s is %s. Waiting up to %s for the operation to finish", options.StackName, status, options.WaitTimeout)
+
+		if status, err = d.watchOperation(aws.StringValue(stack.StackId), "", nil, options.WaitTimeout); err != nil {
+			return err
+		}
+	}
+
+	if status == cloudformation.StackStatusUpdateRollbackFailed {
+		return fmt.Errorf("Stack %s is %s and cannot be updated. Fix the resources that failed to roll back, then run continue-update-rollback", options.StackName, status)
+	}
+
+	return nil
+}
+
+// checkServiceRole logs a warning if the service role given in options differs
+// from the role currently used by the stack
+func checkServiceRole(stack *cloudformation.Stack, options *DeployOptions) {
+	if options.ServiceRoleARN == "" {
+		return
+	}
+
+	if current := aws.StringValue(stack.RoleARN); current != options.ServiceRoleARN {
+		log.Printf("Warning: stack %s currently uses service role '%s', it will be updated to use '%s'", options.StackName, current, options.ServiceRoleARN)
+	}
+}
+
+// reviewUpdate reviews the changes of a change set. It returns an error if the
+// update would remove or replace protected resources that are not explicitly
+// allowed, or if the update is not approved.
+func (d *deployer) reviewUpdate(stack *cloudformation.Stack, options *DeployOptions, cs *changeSet, params StackParams, noEcho map[string]bool) error {
+	if !options.AllowDestructive {
+		if err := checkDestructiveChanges(cs.changes, options); err != nil {
+			return err
+		}
+	}
+
+	return approve(options, &Preview{
+		StackName:  options.StackName,
+		Exists:     true,
+		Changes:    cs.changes,
+		Parameters: diffParameters(stack.Parameters, maskNoEcho(params, noEcho)),
+	})
+}
+
+// reviewCreate asks for approval to create the stack, listing the resources
+// that the change set creates
+func (d *deployer) reviewCreate(options *DeployOptions, cs *changeSet, params StackParams, noEcho map[string]bool) error {
+	return approve(options, &Preview{
+		StackName:  options.StackName,
+		Changes:    cs.changes,
+		Parameters: diffParameters(nil, maskNoEcho(params, noEcho)),
+	})
+}
+
+// checkDestructiveChanges returns an error if changes remove or replace
+// protected resources that are not explicitly allowed
+func checkDestructiveChanges(changes []*ResourceChange, options *DeployOptions) error {
+	protectedTypes := options.ProtectedResourceTypes
+
+	if protectedTypes == nil {
+		protectedTypes = DefaultProtectedResourceTypes
+	}
+
+	if destructive := findDestructiveChanges(changes, protectedTypes, options.AllowReplace); len(destructive) > 0 {
+		return destructiveChangesError(destructive)
+	}
+
+	return nil
+}
+
+// approve passes preview to the Approve function of options, if any, and
+// returns ErrNotApproved if it is declined
+func approve(options *DeployOptions, preview *Preview) error {
+	if options.Approve == nil {
+		return nil
+	}
+
+	ok, err := options.Approve(preview)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrNotApproved
+	}
+
+	return nil
+}
+
+// updateTerminationProtection enables or disables termination protection of
+// an existing stack, if it differs from the setting given in options
+func (d *deployer) updateTerminationProtection(stack *cloudformation.Stack, options *DeployOptions) error {
+	if options.TerminationProtection == nil {
+		return nil
+	}
+
+	enable := *options.TerminationProtection
+
+	if aws.BoolValue(stack.EnableTerminationProtection) == enable {
+		return nil
+	}
+
+	log.Printf("Setting termination protection to %t", enable)
+
+	_, err := d.svc.UpdateTerminationProtection(&cloudformation.UpdateTerminationProtectionInput{
+		StackName:                   aws.String(options.StackName),
+		EnableTerminationProtection: aws.Bool(enable),
+	})
+
 	return err
 }
 
-// create creates a cloudforamtion stack
-func (d *deployer) create(stackName, templateURL string, params StackParams, tags StackTags) (string, error) {
-	if resp, err := d.svc.CreateStack(d.buildCreateStackInput(stackName, templateURL, params, tags)); err == nil {
-		return *resp.StackId, nil
-	} else {
-		return "", err
+// create creates a cloudforamtion stack. If the creation has to be approved,
+// it creates a change set that creates the stack, reviews its changes, then
+// executes that change set. As a change set can not set termination
+// protection or the stack policy, it then returns a function that sets them
+// once the stack has been created.
+func (d *deployer) create(options *DeployOptions, templateURL string, params StackParams, noEcho map[string]bool) (string, func() error, error) {
+	if options.Approve == nil {
+		resp, err := d.svc.CreateStack(d.buildCreateStackInput(options, templateURL, params))
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		return aws.StringValue(resp.StackId), nil, nil
+	}
+
+	if options.TimeoutInMinutes > 0 {
+		log.Printf("Warning: the timeout is ignored, as it can not be set on a change set")
+	}
+
+	cs, err := d.createChangeSet(options, templateURL, params, cloudformation.ChangeSetTypeCreate)
+
+	if err != nil {
+		return "", nil, err
 	}
+
+	err = d.reviewCreate(options, cs, params, noEcho)
+
+	if err == nil {
+		_, err = d.executeChangeSet(cs, options)
+	}
+
+	if err != nil {
+		d.discardChangeSet(cs, cloudformation.ChangeSetTypeCreate)
+		return "", nil, err
+	}
+
+	return cs.stackID, func() error {
+		return d.protectStack(cs.stackID, options)
+	}, nil
+}
+
+// protectStack sets termination protection and the stack policy of a stack
+// that was created by a change set
+func (d *deployer) protectStack(stackID string, options *DeployOptions) error {
+	if err := d.updateTerminationProtection(&cloudformation.Stack{StackId: aws.String(stackID)}, options); err != nil {
+		return err
+	}
+
+	if options.StackPolicy == "" {
+		return nil
+	}
+
+	log.Printf("Setting stack policy")
+	return d.SetStackPolicy(stackID, options.StackPolicy)
 }
 
 // buildCreateStackInput builds up the CreateStackInput struct
-func (d *deployer) buildCreateStackInput(stackName, templateURL string, params StackParams, tags StackTags) *cloudformation.CreateStackInput {
+func (d *deployer) buildCreateStackInput(options *DeployOptions, templateURL string, params StackParams) *cloudformation.CreateStackInput {
 	createStackInput := &cloudformation.CreateStackInput{
-		StackName:   aws.String(stackName),
+		StackName:   aws.String(options.StackName),
 		Parameters:  params.AWSParams(),
-		Tags:        tags.AWSTags(),
+		Tags:        options.StackTags.AWSTags(),
 		TemplateURL: aws.String(templateURL),
 		Capabilities: []*string{
 			aws.String(cloudformation.CapabilityCapabilityIam),
 		},
 	}
 
+	if options.ServiceRoleARN != "" {
+		createStackInput.RoleARN = aws.String(options.ServiceRoleARN)
+	}
+
+	if options.NotificationARNs != nil {
+		createStackInput.NotificationARNs = aws.StringSlice(options.NotificationARNs)
+	}
+
+	if options.TimeoutInMinutes > 0 {
+		createStackInput.TimeoutInMinutes = aws.Int64(options.TimeoutInMinutes)
+	}
+
+	if options.OnFailure != "" {
+		createStackInput.OnFailure = aws.String(options.OnFailure)
+	} else if options.DisableRollback {
+		createStackInput.DisableRollback = aws.Bool(true)
+	}
+
+	if options.TerminationProtection != nil {
+		createStackInput.EnableTerminationProtection = aws.Bool(*options.TerminationProtection)
+	}
+
+	if options.ClientRequestToken != "" {
+		createStackInput.ClientRequestToken = aws.String(options.ClientRequestToken)
+	}
+
+	if options.StackPolicy != "" {
+		createStackInput.StackPolicyBody = aws.String(options.StackPolicy)
+	}
+
+	if options.RollbackConfiguration != nil {
+		createStackInput.RollbackConfiguration = options.RollbackConfiguration.AWSRollbackConfiguration()
+	}
+
 	return createStackInput
 }
 
@@ -137,27 +629,165 @@ func (d *deployer) buildStackParams(version, mainTemplateURL string, params Stac
 	return params
 }
 
-// update updates a cloudformation stack
-func (d *deployer) update(stackName, templateURL string, params StackParams, tags StackTags) (string, error) {
-	if resp, err := d.svc.UpdateStack(d.buildUpdateStackInput(stackName, templateURL, params, tags)); err == nil {
-		return *resp.StackId, nil
-	} else {
-		return "", err
+// update updates a cloudformation stack. Unless the update needs no review,
+// because destructive changes are allowed and no approval is asked for, it
+// creates a change set, reviews its changes, then executes that change set,
+// so that exactly the reviewed changes are made. It returns the ID of the
+// stack, and a function that restores the stack policy if it was overridden
+// during the update.
+func (d *deployer) update(stack *cloudformation.Stack, options *DeployOptions, templateURL string, params StackParams, noEcho map[string]bool) (string, func(), error) {
+	if options.AllowDestructive && options.Approve == nil {
+		if err := d.updateTerminationProtection(stack, options); err != nil {
+			return "", nil, err
+		}
+
+		resp, err := d.svc.UpdateStack(d.buildUpdateStackInput(options, templateURL, params))
+
+		if isNoUpdates(err) {
+			return "", nil, errNoChanges
+		}
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		return aws.StringValue(resp.StackId), nil, nil
+	}
+
+	cs, err := d.createChangeSet(options, templateURL, params, cloudformation.ChangeSetTypeUpdate)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	restorePolicy, err := d.reviewAndExecute(stack, options, cs, params, noEcho)
+
+	if err != nil {
+		d.discardChangeSet(cs, cloudformation.ChangeSetTypeUpdate)
+		return "", nil, err
 	}
+
+	return cs.stackID, restorePolicy, nil
+}
+
+// reviewAndExecute reviews a change set that updates the stack, and executes
+// it if it is approved. The change set is not deleted if it fails.
+func (d *deployer) reviewAndExecute(stack *cloudformation.Stack, options *DeployOptions, cs *changeSet, params StackParams, noEcho map[string]bool) (func(), error) {
+	if err := d.reviewUpdate(stack, options, cs, params, noEcho); err != nil {
+		return nil, err
+	}
+
+	if err := d.updateTerminationProtection(stack, options); err != nil {
+		return nil, err
+	}
+
+	var (
+		restorePolicy func()
+		err           error
+	)
+
+	// change sets can not set the stack policy, so it is set before the
+	// change set is executed
+	switch {
+	case options.StackPolicyDuringUpdate != "":
+		restorePolicy, err = d.overrideStackPolicy(cs.stackID, options)
+	case options.StackPolicy != "":
+		log.Printf("Setting stack policy")
+		err = d.SetStackPolicy(cs.stackID, options.StackPolicy)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.executeChangeSet(cs, options); err != nil {
+		if restorePolicy != nil {
+			restorePolicy()
+		}
+		return nil, err
+	}
+
+	return restorePolicy, nil
+}
+
+// overrideStackPolicy replaces the stack policy with the policy that applies
+// during the update, as change sets can not override the stack policy. It
+// returns a function that restores the stack policy, which must be called
+// once the update has finished.
+func (d *deployer) overrideStackPolicy(stackID string, options *DeployOptions) (func(), error) {
+	policy := options.StackPolicy
+
+	if policy == "" {
+		current, err := d.StackPolicy(stackID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		policy = current
+	}
+
+	if policy == "" {
+		policy = allowAllStackPolicy
+	}
+
+	log.Printf("Overriding stack policy during the update")
+
+	if err := d.SetStackPolicy(stackID, options.StackPolicyDuringUpdate); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		log.Printf("Restoring stack policy")
+
+		if err := d.SetStackPolicy(stackID, policy); err != nil {
+			log.Printf("Unable to restore the stack policy of stack %s: %s", stackID, err.Error())
+		}
+	}, nil
+}
+
+// isNoUpdates returns true if err means that an update of a stack contained no
+// changes
+func isNoUpdates(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "No updates are to be performed")
 }
 
 // buildUpdateStackInput builds up the CreateStackInput struct
-func (d *deployer) buildUpdateStackInput(stackName, templateURL string, params StackParams, tags StackTags) *cloudformation.UpdateStackInput {
+func (d *deployer) buildUpdateStackInput(options *DeployOptions, templateURL string, params StackParams) *cloudformation.UpdateStackInput {
 	updateStackInput := &cloudformation.UpdateStackInput{
-		StackName:   aws.String(stackName),
+		StackName:   aws.String(options.StackName),
 		Parameters:  params.AWSParams(),
-		Tags:        tags.AWSTags(),
+		Tags:        options.StackTags.AWSTags(),
 		TemplateURL: aws.String(templateURL),
 		Capabilities: []*string{
 			aws.String(cloudformation.CapabilityCapabilityIam),
 		},
 	}
 
+	if options.ServiceRoleARN != "" {
+		updateStackInput.RoleARN = aws.String(options.ServiceRoleARN)
+	}
+
+	if options.NotificationARNs != nil {
+		updateStackInput.NotificationARNs = aws.StringSlice(options.NotificationARNs)
+	}
+
+	if options.ClientRequestToken != "" {
+		updateStackInput.ClientRequestToken = aws.String(options.ClientRequestToken)
+	}
+
+	if options.StackPolicy != "" {
+		updateStackInput.StackPolicyBody = aws.String(options.StackPolicy)
+	}
+
+	if options.RollbackConfiguration != nil {
+		updateStackInput.RollbackConfiguration = options.RollbackConfiguration.AWSRollbackConfiguration()
+	}
+
+	if options.StackPolicyDuringUpdate != "" {
+		updateStackInput.StackPolicyDuringUpdateBody = aws.String(options.StackPolicyDuringUpdate)
+	}
+
 	return updateStackInput
 }
 
@@ -220,6 +850,28 @@ func findTemplates(dir string) ([]string, error) {
 	})
 }
 
+// clientRequestToken generates a token that identifies a stack operation
+// started at time t
+func clientRequestToken(operation string, t time.Time) string {
+	return fmt.Sprintf("cfndeploy-%s-%d", operation, t.Unix())
+}
+
+// deploymentToken generates the token that identifies the deployment of a
+// template version to a stack, started at time t. The start time makes the
+// token unique to each run, so that deploying a version again, after a
+// failure or to go back to it, is never mistaken for a retry of an earlier
+// operation that has already finished.
+func deploymentToken(stackName, version string, t time.Time) string {
+	suffix := fmt.Sprintf("-%s-%d", version, t.UnixNano())
+
+	// tokens are limited to 128 characters
+	if max := 128 - len("cfndeploy-") - len(suffix); len(stackName) > max {
+		stackName = stackName[:max]
+	}
+
+	return "cfndeploy-" + stackName + suffix
+}
+
 // calculateBucketPrefix returns the appropriate bucket key prefix for the given
 // stackName, bucketFolder and version
 func calculateBucketPrefix(stackName, bucketFolder, version string) string {
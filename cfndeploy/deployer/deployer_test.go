@@ -6,7 +6,9 @@ import (
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/bernos/cfn-deploy/cfndeploy/uploader"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -21,7 +23,7 @@ func TestDeploy(t *testing.T) {
 	s3 := s3manager.NewUploader(sess)
 	cw := cloudformation.New(sess)
 	u := uploader.New(s3)
-	d := New(cw, u)
+	d := New(cw, u, nil, nil, nil)
 
 	o := &DeployOptions{
 		Bucket:         defaultBucket,
@@ -82,3 +84,96 @@ func TestChecksumTemplates(t *testing.T) {
 	sum, _ := checksumTemplates(files)
 	t.Error(sum)
 }
+
+func TestBuildStackInputServiceRole(t *testing.T) {
+	d := &deployer{}
+	role := "arn:aws:iam::123456789012:role/cfn-service-role"
+	o := &DeployOptions{
+		StackName:      defaultStackName,
+		ServiceRoleARN: role,
+	}
+
+	create := d.buildCreateStackInput(o, "http://example.com/Stack.json", StackParams{})
+
+	if aws.StringValue(create.RoleARN) != role {
+		t.Errorf("Want %s, got %s", role, aws.StringValue(create.RoleARN))
+	}
+
+	update := d.buildUpdateStackInput(o, "http://example.com/Stack.json", StackParams{})
+
+	if aws.StringValue(update.RoleARN) != role {
+		t.Errorf("Want %s, got %s", role, aws.StringValue(update.RoleARN))
+	}
+
+	o.ServiceRoleARN = ""
+
+	if update := d.buildUpdateStackInput(o, "http://example.com/Stack.json", StackParams{}); update.RoleARN != nil {
+		t.Errorf("Want no role, got %s", aws.StringValue(update.RoleARN))
+	}
+}
+
+func TestIsBusy(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{"UPDATE_IN_PROGRESS", true},
+		{"UPDATE_ROLLBACK_COMPLETE_CLEANUP_IN_PROGRESS", true},
+		{"REVIEW_IN_PROGRESS", false},
+		{"UPDATE_COMPLETE", false},
+		{"UPDATE_ROLLBACK_FAILED", false},
+	}
+
+	for _, tt := range tests {
+		if got := isBusy(tt.status); got != tt.want {
+			t.Errorf("Want %t for %s, got %t", tt.want, tt.status, got)
+		}
+	}
+}
+
+func TestDeploymentToken(t *testing.T) {
+	start := time.Date(2016, 5, 1, 10, 30, 0, 0, time.UTC)
+	token := deploymentToken("stack", "1234abcd", start)
+
+	if !strings.HasPrefix(token, "cfndeploy-stack-1234abcd-") {
+		t.Errorf("Want a token naming the stack and version, got %s", token)
+	}
+
+	tests := []struct {
+		stackName string
+		version   string
+		start     time.Time
+	}{
+		{"other", "1234abcd", start},
+		{"stack", "5678abcd", start},
+		{"stack", "1234abcd", start.Add(time.Second)},
+		{"stack", "1234abcd", start.Add(time.Millisecond)},
+	}
+
+	for _, tt := range tests {
+		if other := deploymentToken(tt.stackName, tt.version, tt.start); other == token {
+			t.Errorf("Want a different token for %s %s %s, got %s", tt.stackName, tt.version, tt.start, other)
+		}
+	}
+
+	if long := deploymentToken(strings.Repeat("a", 128), "1234abcd", start); len(long) > 128 {
+		t.Errorf("Want a token of at most 128 characters, got %d", len(long))
+	}
+}
+
+func TestDeployTimeout(t *testing.T) {
+	tests := []struct {
+		timeoutInMinutes int64
+		want             time.Duration
+	}{
+		{0, operationTimeout},
+		{5, operationTimeout},
+		{60, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := deployTimeout(&DeployOptions{TimeoutInMinutes: tt.timeoutInMinutes}); got != tt.want {
+			t.Errorf("Want %s, got %s", tt.want, got)
+		}
+	}
+}
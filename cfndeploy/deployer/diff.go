@@ -0,0 +1,424 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Kinds of template change
+const (
+	TemplateChangeAdd    = "Add"
+	TemplateChangeRemove = "Remove"
+	TemplateChangeModify = "Modify"
+)
+
+// managedParameters are set by cfndeploy on every deployment, so they are not
+// compared
+var managedParameters = []string{"Version", "TemplateBaseUrl"}
+
+// Diff holds the differences between the local templates, parameters and tags
+// and those of a deployed stack
+type Diff struct {
+	StackName string
+
+	// Templates holds the differences of the main template, followed by those
+	// of each nested stack
+	Templates []*TemplateDiff
+
+	Parameters []ParameterChange
+
+	// Tags holds the tag changes, using the parameter change fields. Tags are
+	// only compared if tags are given.
+	Tags []ParameterChange
+}
+
+// TemplateDiff holds the differences between a local template and the
+// template of a deployed stack
+type TemplateDiff struct {
+	// Path is the nested stack path of the stack, which is empty for the root
+	// stack
+	Path string
+
+	// Template is the local template, relative to the template folder. It is
+	// empty if no local template was found for a nested stack.
+	Template string
+
+	Changes []*TemplateChange
+}
+
+// TemplateChange is a difference at a single property path of a template
+type TemplateChange struct {
+	Kind string
+
+	// Path is the dot separated path of the property, such as
+	// Resources.Queue.Properties.VisibilityTimeout. List items are given as
+	// Tags[0].
+	Path string
+
+	Live  interface{}
+	Local interface{}
+}
+
+// Diff compares the local templates, parameters and tags with those of the
+// deployed stack and its nested stacks. Local templates are rendered, their
+// includes resolved, and their artifacts packaged first, so that properties
+// that refer to local files are compared with the S3 locations a deployment
+// would upload them to. Both sides are normalised, so that JSON and YAML
+// templates, and the order of keys, do not matter.
+func (d *deployer) Diff(options *DeployOptions) (*Diff, error) {
+	mainTemplate := filepath.Join(options.TemplateFolder, options.MainTemplate)
+
+	b, err := newBuild(options.TemplateFolder, mainTemplate, options.TemplateVars)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer b.Close()
+
+	if _, _, err := b.packageTemplates(options); err != nil {
+		return nil, err
+	}
+
+	stack, err := d.helper.DescribeStack(options.StackName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := ioutil.ReadFile(b.mainTemplate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := parseTemplateBody(buf)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template %s: %s", b.mainTemplate, err.Error())
+	}
+
+	live, desired := deployedParameters(template, withoutManaged(stack.Parameters), options.StackParams)
+
+	// the live values of NoEcho parameters are masked, so the local values
+	// are masked too rather than shown
+	diff := &Diff{
+		StackName:  options.StackName,
+		Parameters: diffParameters(live, maskNoEcho(desired, noEchoParameters(template))),
+	}
+
+	if len(options.StackTags) > 0 {
+		diff.Tags = diffTags(stack.Tags, options.StackTags)
+	}
+
+	if diff.Templates, err = d.diffTemplates(b, aws.StringValue(stack.StackId), b.mainTemplate, ""); err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+// diffTemplates compares the staged template with the template of the stack,
+// then does the same for each nested stack
+func (d *deployer) diffTemplates(b *build, stackID, template, path string) ([]*TemplateDiff, error) {
+	resp, err := d.svc.GetTemplate(&cloudformation.GetTemplateInput{
+		StackName:     aws.String(stackID),
+		TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := parseTemplateBody([]byte(aws.StringValue(resp.TemplateBody)))
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse the template of stack %s: %s", stackID, err.Error())
+	}
+
+	buf, err := ioutil.ReadFile(template)
+
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := parseTemplateBody(buf)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template %s: %s", b.sources[template], err.Error())
+	}
+
+	rel, _ := filepath.Rel(b.templateDir, template)
+
+	diffs := []*TemplateDiff{{
+		Path:     path,
+		Template: rel,
+		Changes:  diffValues("", normalise(live), normalise(local)),
+	}}
+
+	nested, err := d.nestedStacks(stackID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range nested {
+		logicalID := aws.StringValue(r.LogicalResourceId)
+		nestedPath := logicalID
+
+		if path != "" {
+			nestedPath = path + "." + logicalID
+		}
+
+		nestedTemplate := b.nestedTemplate(local, logicalID)
+
+		if nestedTemplate == "" {
+			diffs = append(diffs, &TemplateDiff{Path: nestedPath})
+			continue
+		}
+
+		nestedDiffs, err := d.diffTemplates(b, aws.StringValue(r.PhysicalResourceId), nestedTemplate, nestedPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		diffs = append(diffs, nestedDiffs...)
+	}
+
+	return diffs, nil
+}
+
+// nestedTemplate returns the staged template of the nested stack resource
+// with the given logical ID in template. The template is found by matching
+// the strings of its TemplateURL property, such as the file name joined to
+// the TemplateBaseUrl parameter, with the paths of the staged templates.
+func (b *build) nestedTemplate(template interface{}, logicalID string) string {
+	doc, _ := template.(map[string]interface{})
+	resources, _ := doc["Resources"].(map[string]interface{})
+	resource, _ := resources[logicalID].(map[string]interface{})
+	properties, _ := resource["Properties"].(map[string]interface{})
+
+	if properties == nil {
+		return ""
+	}
+
+	var (
+		match   string
+		longest int
+	)
+
+	for _, s := range stringsIn(properties["TemplateURL"]) {
+		for _, staged := range b.templates {
+			rel, err := filepath.Rel(b.templateDir, staged)
+
+			if err != nil {
+				continue
+			}
+
+			rel = filepath.ToSlash(rel)
+
+			if strings.HasSuffix(s, rel) && (s == rel || strings.HasSuffix(s, "/"+rel) || strings.HasSuffix(s, "}"+rel)) && len(rel) > longest {
+				match, longest = staged, len(rel)
+			}
+		}
+	}
+
+	return match
+}
+
+// stringsIn returns all strings held in value
+func stringsIn(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var all []string
+		for _, child := range v {
+			all = append(all, stringsIn(child)...)
+		}
+		return all
+	case map[string]interface{}:
+		var all []string
+		for _, child := range v {
+			all = append(all, stringsIn(child)...)
+		}
+		return all
+	}
+	return nil
+}
+
+// normalise converts numbers and booleans to strings, as cloudformation
+// treats them alike, so that JSON and YAML templates compare equal
+func normalise(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for key, child := range v {
+			m[key] = normalise(child)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, child := range v {
+			list[i] = normalise(child)
+		}
+		return list
+	case json.Number:
+		return v.String()
+	case nil, string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// diffValues returns the changes from live to local below path. Objects are
+// compared by key, and lists by index.
+func diffValues(path string, live, local interface{}) []*TemplateChange {
+	liveMap, liveIsMap := live.(map[string]interface{})
+	localMap, localIsMap := local.(map[string]interface{})
+
+	if liveIsMap && localIsMap {
+		var (
+			changes []*TemplateChange
+			keys    []string
+		)
+
+		for key := range liveMap {
+			keys = append(keys, key)
+		}
+
+		for key := range localMap {
+			if _, ok := liveMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			childPath := key
+
+			if path != "" {
+				childPath = path + "." + key
+			}
+
+			liveValue, inLive := liveMap[key]
+			localValue, inLocal := localMap[key]
+
+			switch {
+			case !inLive:
+				changes = append(changes, &TemplateChange{Kind: TemplateChangeAdd, Path: childPath, Local: localValue})
+			case !inLocal:
+				changes = append(changes, &TemplateChange{Kind: TemplateChangeRemove, Path: childPath, Live: liveValue})
+			default:
+				changes = append(changes, diffValues(childPath, liveValue, localValue)...)
+			}
+		}
+
+		return changes
+	}
+
+	liveList, liveIsList := live.([]interface{})
+	localList, localIsList := local.([]interface{})
+
+	if liveIsList && localIsList {
+		var changes []*TemplateChange
+
+		for i := 0; i < len(liveList) || i < len(localList); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+
+			switch {
+			case i >= len(liveList):
+				changes = append(changes, &TemplateChange{Kind: TemplateChangeAdd, Path: childPath, Local: localList[i]})
+			case i >= len(localList):
+				changes = append(changes, &TemplateChange{Kind: TemplateChangeRemove, Path: childPath, Live: liveList[i]})
+			default:
+				changes = append(changes, diffValues(childPath, liveList[i], localList[i])...)
+			}
+		}
+
+		return changes
+	}
+
+	if reflect.DeepEqual(live, local) {
+		return nil
+	}
+
+	return []*TemplateChange{{Kind: TemplateChangeModify, Path: path, Live: live, Local: local}}
+}
+
+// withoutManaged returns the parameters that are not managed by cfndeploy
+func withoutManaged(params []*cloudformation.Parameter) []*cloudformation.Parameter {
+	var filtered []*cloudformation.Parameter
+
+	for _, p := range params {
+		if !contains(managedParameters, aws.StringValue(p.ParameterKey)) {
+			filtered = append(filtered, p)
+		}
+	}
+
+	return filtered
+}
+
+// deployedParameters returns the live parameters to compare, and the
+// parameters that deploying the template with the given parameters would set.
+// Parameters that are not given take the Default of their declaration in the
+// template. Parameters that have no default either are not compared, as the
+// deployment would fail rather than change them. Live parameters that the
+// template no longer declares are compared, so that they show as removed.
+func deployedParameters(template interface{}, live []*cloudformation.Parameter, given StackParams) ([]*cloudformation.Parameter, StackParams) {
+	doc, _ := template.(map[string]interface{})
+	declared, _ := doc["Parameters"].(map[string]interface{})
+
+	desired := make(StackParams)
+
+	for key, value := range given {
+		desired[key] = value
+	}
+
+	unset := make(map[string]bool)
+
+	for key, value := range declared {
+		if _, ok := desired[key]; ok || contains(managedParameters, key) {
+			continue
+		}
+
+		declaration, _ := value.(map[string]interface{})
+
+		if def, ok := declaration["Default"]; ok {
+			desired[key] = fmt.Sprint(def)
+		} else {
+			unset[key] = true
+		}
+	}
+
+	var compared []*cloudformation.Parameter
+
+	for _, p := range live {
+		if !unset[aws.StringValue(p.ParameterKey)] {
+			compared = append(compared, p)
+		}
+	}
+
+	return compared, desired
+}
+
+// diffTags returns the changes from the current tags of a stack to the
+// desired tags, sorted by key
+func diffTags(current []*cloudformation.Tag, desired StackTags) []ParameterChange {
+	var params []*cloudformation.Parameter
+
+	for _, t := range current {
+		params = append(params, &cloudformation.Parameter{ParameterKey: t.Key, ParameterValue: t.Value})
+	}
+
+	return diffParameters(params, StackParams(desired))
+}
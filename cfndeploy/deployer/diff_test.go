@@ -0,0 +1,248 @@
+package deployer
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// templateAPI returns canned templates for each stack
+type templateAPI struct {
+	driftAPI
+	stack     *cloudformation.Stack
+	templates map[string]string
+}
+
+func (api *templateAPI) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	return &cloudformation.DescribeStacksOutput{Stacks: []*cloudformation.Stack{api.stack}}, nil
+}
+
+func (api *templateAPI) GetTemplate(input *cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
+	return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(api.templates[aws.StringValue(input.StackName)])}, nil
+}
+
+const liveStack = `
+AWSTemplateFormatVersion: 2010-09-09
+Parameters:
+  TemplateBaseUrl:
+    Type: String
+  Version:
+    Type: String
+Resources:
+  WebLoadBalancer:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: !Join ["", [!Ref TemplateBaseUrl, LoadBalancer.json]]
+      Parameters:
+        TemplateBaseUrl: !Ref TemplateBaseUrl
+        Version: !Ref Version
+Outputs:
+  Version:
+    Value: !Ref Version
+`
+
+const liveLoadBalancer = `{
+    "AWSTemplateFormatVersion": "2010-09-09",
+    "Description": "",
+    "Parameters": {"Version": {"Type": "String"}, "TemplateBaseUrl": {"Type": "String"}},
+    "Resources": {
+        "WebLoadBalancer": {
+            "Type": "AWS::ElasticLoadBalancing::LoadBalancer",
+            "Properties": {
+                "Subnets": ["subnet-039fc374", "subnet-7e41771b"],
+                "Listeners": [{"LoadBalancerPort": 80, "InstancePort": 8080, "Protocol": "HTTP"}],
+                "CrossZone": true
+            }
+        }
+    }
+}`
+
+func TestDiff(t *testing.T) {
+	api := &templateAPI{
+		driftAPI: driftAPI{
+			nested: map[string][]*cloudformation.StackResourceSummary{
+				"root": {{
+					LogicalResourceId:  aws.String("WebLoadBalancer"),
+					ResourceType:       aws.String("AWS::CloudFormation::Stack"),
+					PhysicalResourceId: aws.String("web"),
+				}},
+			},
+		},
+		stack: &cloudformation.Stack{
+			StackName: aws.String("stack"),
+			StackId:   aws.String("root"),
+			Parameters: []*cloudformation.Parameter{
+				{ParameterKey: aws.String("Version"), ParameterValue: aws.String("abc")},
+				{ParameterKey: aws.String("Env"), ParameterValue: aws.String("test")},
+			},
+			Tags: []*cloudformation.Tag{{Key: aws.String("Team"), Value: aws.String("web")}},
+		},
+		templates: map[string]string{"root": liveStack, "web": liveLoadBalancer},
+	}
+
+	d := &deployer{svc: api, helper: &cloudFormationHelper{api}}
+
+	diff, err := d.Diff(&DeployOptions{
+		StackName:      "stack",
+		TemplateFolder: "./test-fixtures/templates/valid",
+		MainTemplate:   "Stack.json",
+		StackParams:    StackParams{"Env": "prod"},
+	})
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	if len(diff.Templates) != 2 {
+		t.Fatalf("Want 2 template diffs, got %d", len(diff.Templates))
+	}
+
+	if root := diff.Templates[0]; root.Template != "Stack.json" || len(root.Changes) != 0 {
+		t.Errorf("Want no changes to Stack.json, got %s %v", root.Template, root.Changes)
+	}
+
+	web := diff.Templates[1]
+
+	if web.Path != "WebLoadBalancer" || web.Template != "LoadBalancer.json" {
+		t.Errorf("Want WebLoadBalancer (LoadBalancer.json), got %s (%s)", web.Path, web.Template)
+	}
+
+	wantChanges := []*TemplateChange{
+		{Kind: TemplateChangeRemove, Path: "Resources.WebLoadBalancer.Properties.CrossZone", Live: "true"},
+		{Kind: TemplateChangeModify, Path: "Resources.WebLoadBalancer.Properties.Listeners[0].InstancePort", Live: "8080", Local: "80"},
+		{Kind: TemplateChangeAdd, Path: "Resources.WebLoadBalancer.Properties.Subnets[2]", Local: "subnet-f4d3e5b2"},
+	}
+
+	if !reflect.DeepEqual(web.Changes, wantChanges) {
+		t.Errorf("Want changes")
+		for _, c := range wantChanges {
+			t.Errorf("  %v", c)
+		}
+		t.Errorf("got")
+		for _, c := range web.Changes {
+			t.Errorf("  %v", c)
+		}
+	}
+
+	wantParams := []ParameterChange{{Key: "Env", Current: "test", Desired: "prod"}}
+
+	if !reflect.DeepEqual(diff.Parameters, wantParams) {
+		t.Errorf("Want parameter changes %v, got %v", wantParams, diff.Parameters)
+	}
+
+	if diff.Tags != nil {
+		t.Errorf("Want tags not compared, got %v", diff.Tags)
+	}
+}
+
+func TestDiffPackagesArtifacts(t *testing.T) {
+	folder := "./test-fixtures/templates/lambda"
+
+	options := &DeployOptions{
+		StackName:      "stack",
+		Bucket:         "bucket",
+		TemplateFolder: folder,
+		MainTemplate:   "Stack.json",
+	}
+
+	// the live template is the template as it was packaged by a deployment
+	b, err := newBuild(folder, filepath.Join(folder, "Stack.json"), nil)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer b.Close()
+
+	if _, _, err := b.packageTemplates(options); err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	live, err := ioutil.ReadFile(b.mainTemplate)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	api := &templateAPI{
+		stack:     &cloudformation.Stack{StackName: aws.String("stack"), StackId: aws.String("root")},
+		templates: map[string]string{"root": string(live)},
+	}
+
+	d := &deployer{svc: api, helper: &cloudFormationHelper{api}}
+
+	diff, err := d.Diff(options)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	if changes := diff.Templates[0].Changes; len(changes) != 0 {
+		t.Errorf("Want no changes to the packaged template, got %v", changes)
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	tests := []struct {
+		live, local interface{}
+		want        []*TemplateChange
+	}{
+		{"a", "a", nil},
+		{"a", "b", []*TemplateChange{{Kind: TemplateChangeModify, Live: "a", Local: "b"}}},
+		{
+			map[string]interface{}{"A": "1", "B": "2"},
+			map[string]interface{}{"B": "2", "C": "3"},
+			[]*TemplateChange{
+				{Kind: TemplateChangeRemove, Path: "A", Live: "1"},
+				{Kind: TemplateChangeAdd, Path: "C", Local: "3"},
+			},
+		},
+		{
+			map[string]interface{}{"A": []interface{}{"1"}},
+			map[string]interface{}{"A": map[string]interface{}{"Ref": "B"}},
+			[]*TemplateChange{{Kind: TemplateChangeModify, Path: "A", Live: []interface{}{"1"}, Local: map[string]interface{}{"Ref": "B"}}},
+		},
+	}
+
+	for _, test := range tests {
+		if got := diffValues("", test.live, test.local); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Want %v, got %v", test.want, got)
+		}
+	}
+}
+
+func TestDeployedParameters(t *testing.T) {
+	template := map[string]interface{}{
+		"Parameters": map[string]interface{}{
+			"Env":     map[string]interface{}{"Type": "String"},
+			"Size":    map[string]interface{}{"Type": "Number", "Default": json.Number("2")},
+			"Image":   map[string]interface{}{"Type": "String", "Default": "nginx"},
+			"Subnets": map[string]interface{}{"Type": "String"},
+			"Version": map[string]interface{}{"Type": "String"},
+		},
+	}
+
+	live := []*cloudformation.Parameter{
+		{ParameterKey: aws.String("Env"), ParameterValue: aws.String("test")},
+		{ParameterKey: aws.String("Size"), ParameterValue: aws.String("2")},
+		{ParameterKey: aws.String("Image"), ParameterValue: aws.String("httpd")},
+		{ParameterKey: aws.String("Subnets"), ParameterValue: aws.String("subnet-1")},
+		{ParameterKey: aws.String("Legacy"), ParameterValue: aws.String("old")},
+	}
+
+	compared, desired := deployedParameters(template, live, StackParams{"Env": "prod"})
+
+	want := []ParameterChange{
+		{Key: "Env", Current: "test", Desired: "prod"},
+		{Key: "Image", Current: "httpd", Desired: "nginx"},
+		{Key: "Legacy", Current: "old"},
+	}
+
+	if got := diffParameters(compared, desired); !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %v, got %v", want, got)
+	}
+}
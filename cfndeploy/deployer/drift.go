@@ -0,0 +1,149 @@
+package deployer
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"log"
+	"time"
+)
+
+var (
+	// driftPollInterval is the time between polls of the status of a drift
+	// detection
+	driftPollInterval = time.Second * 5
+
+	// driftTimeout is the maximum time to wait for the drift detection of a
+	// single stack
+	driftTimeout = time.Minute * 10
+)
+
+// ResourceDrift is a resource of a stack, or of one of its nested stacks, that
+// differs from its expected configuration
+type ResourceDrift struct {
+	*cloudformation.StackResourceDrift
+
+	// Path is the logical ID of the resource, prefixed by the logical IDs of
+	// the nested stacks that contain it, separated by dots
+	Path string
+}
+
+// Drift detects drift of the named stack and its nested stacks, and returns
+// the resources that were modified or deleted outside of cloudformation
+func (d *deployer) Drift(stackName string) ([]*ResourceDrift, error) {
+	stack, err := d.helper.DescribeStack(stackName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d.drift(aws.StringValue(stack.StackId), aws.StringValue(stack.StackName), "")
+}
+
+func (d *deployer) drift(stackID, stackName, pathPrefix string) ([]*ResourceDrift, error) {
+	log.Printf("Detecting drift of stack %s", stackName)
+
+	if err := d.detectDrift(stackID); err != nil {
+		return nil, err
+	}
+
+	var drifts []*ResourceDrift
+
+	params := &cloudformation.DescribeStackResourceDriftsInput{
+		StackName: aws.String(stackID),
+		StackResourceDriftStatusFilters: aws.StringSlice([]string{
+			cloudformation.StackResourceDriftStatusModified,
+			cloudformation.StackResourceDriftStatusDeleted,
+		}),
+	}
+
+	err := d.svc.DescribeStackResourceDriftsPages(params, func(page *cloudformation.DescribeStackResourceDriftsOutput, lastPage bool) bool {
+		for _, drift := range page.StackResourceDrifts {
+			drifts = append(drifts, &ResourceDrift{
+				StackResourceDrift: drift,
+				Path:               pathPrefix + aws.StringValue(drift.LogicalResourceId),
+			})
+		}
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	nested, err := d.nestedStacks(stackID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range nested {
+		nestedDrifts, err := d.drift(aws.StringValue(r.PhysicalResourceId), aws.StringValue(r.PhysicalResourceId), pathPrefix+aws.StringValue(r.LogicalResourceId)+".")
+
+		if err != nil {
+			return nil, err
+		}
+
+		drifts = append(drifts, nestedDrifts...)
+	}
+
+	return drifts, nil
+}
+
+// detectDrift starts drift detection of a single stack, and waits up to
+// driftTimeout for it to complete
+func (d *deployer) detectDrift(stackID string) error {
+	start := time.Now()
+
+	resp, err := d.svc.DetectStackDrift(&cloudformation.DetectStackDriftInput{
+		StackName: aws.String(stackID),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		status, err := d.svc.DescribeStackDriftDetectionStatus(&cloudformation.DescribeStackDriftDetectionStatusInput{
+			StackDriftDetectionId: resp.StackDriftDetectionId,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		switch aws.StringValue(status.DetectionStatus) {
+		case cloudformation.StackDriftDetectionStatusDetectionComplete:
+			return nil
+		case cloudformation.StackDriftDetectionStatusDetectionFailed:
+			return fmt.Errorf("Drift detection of stack %s failed: %s", stackID, aws.StringValue(status.DetectionStatusReason))
+		}
+
+		if time.Since(start) > driftTimeout {
+			return fmt.Errorf("Drift detection of stack %s did not complete within %s", stackID, driftTimeout)
+		}
+
+		time.Sleep(driftPollInterval)
+	}
+}
+
+// nestedStacks returns the nested stack resources of a stack that have been
+// created
+func (d *deployer) nestedStacks(stackID string) ([]*cloudformation.StackResourceSummary, error) {
+	var nested []*cloudformation.StackResourceSummary
+
+	params := &cloudformation.ListStackResourcesInput{
+		StackName: aws.String(stackID),
+	}
+
+	err := d.svc.ListStackResourcesPages(params, func(page *cloudformation.ListStackResourcesOutput, lastPage bool) bool {
+		for _, r := range page.StackResourceSummaries {
+			if aws.StringValue(r.ResourceType) == "AWS::CloudFormation::Stack" && aws.StringValue(r.PhysicalResourceId) != "" {
+				nested = append(nested, r)
+			}
+		}
+		return true
+	})
+
+	return nested, err
+}
@@ -0,0 +1,104 @@
+package deployer
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// driftAPI reports canned drifts for each stack, and the nested stacks of
+// each stack
+type driftAPI struct {
+	cloudformationiface.CloudFormationAPI
+	nested map[string][]*cloudformation.StackResourceSummary
+	drifts map[string][]*cloudformation.StackResourceDrift
+}
+
+func (api *driftAPI) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	return &cloudformation.DescribeStacksOutput{
+		Stacks: []*cloudformation.Stack{{StackName: input.StackName, StackId: input.StackName}},
+	}, nil
+}
+
+func (api *driftAPI) DetectStackDrift(input *cloudformation.DetectStackDriftInput) (*cloudformation.DetectStackDriftOutput, error) {
+	return &cloudformation.DetectStackDriftOutput{StackDriftDetectionId: input.StackName}, nil
+}
+
+func (api *driftAPI) DescribeStackDriftDetectionStatus(input *cloudformation.DescribeStackDriftDetectionStatusInput) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+	return &cloudformation.DescribeStackDriftDetectionStatusOutput{
+		DetectionStatus: aws.String(cloudformation.StackDriftDetectionStatusDetectionComplete),
+	}, nil
+}
+
+func (api *driftAPI) DescribeStackResourceDriftsPages(input *cloudformation.DescribeStackResourceDriftsInput, fn func(*cloudformation.DescribeStackResourceDriftsOutput, bool) bool) error {
+	fn(&cloudformation.DescribeStackResourceDriftsOutput{StackResourceDrifts: api.drifts[aws.StringValue(input.StackName)]}, true)
+	return nil
+}
+
+func (api *driftAPI) ListStackResourcesPages(input *cloudformation.ListStackResourcesInput, fn func(*cloudformation.ListStackResourcesOutput, bool) bool) error {
+	fn(&cloudformation.ListStackResourcesOutput{StackResourceSummaries: api.nested[aws.StringValue(input.StackName)]}, true)
+	return nil
+}
+
+func TestDriftFollowsNestedStacks(t *testing.T) {
+	api := &driftAPI{
+		nested: map[string][]*cloudformation.StackResourceSummary{
+			"root": {
+				{LogicalResourceId: aws.String("Queue"), ResourceType: aws.String("AWS::SQS::Queue"), PhysicalResourceId: aws.String("queue")},
+				{LogicalResourceId: aws.String("Web"), ResourceType: aws.String("AWS::CloudFormation::Stack"), PhysicalResourceId: aws.String("web")},
+			},
+		},
+		drifts: map[string][]*cloudformation.StackResourceDrift{
+			"root": {{LogicalResourceId: aws.String("Queue")}},
+			"web":  {{LogicalResourceId: aws.String("LoadBalancer")}},
+		},
+	}
+
+	d := &deployer{svc: api, helper: &cloudFormationHelper{api}}
+
+	drifts, err := d.Drift("root")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	var paths []string
+
+	for _, drift := range drifts {
+		paths = append(paths, drift.Path)
+	}
+
+	if want := []string{"Queue", "Web.LoadBalancer"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Want %v, got %v", want, paths)
+	}
+}
+
+// slowDriftAPI never completes drift detection
+type slowDriftAPI struct {
+	driftAPI
+}
+
+func (api *slowDriftAPI) DescribeStackDriftDetectionStatus(input *cloudformation.DescribeStackDriftDetectionStatusInput) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+	return &cloudformation.DescribeStackDriftDetectionStatusOutput{
+		DetectionStatus: aws.String(cloudformation.StackDriftDetectionStatusDetectionInProgress),
+	}, nil
+}
+
+func TestDriftTimesOut(t *testing.T) {
+	defer func(interval, timeout time.Duration) {
+		driftPollInterval, driftTimeout = interval, timeout
+	}(driftPollInterval, driftTimeout)
+
+	driftPollInterval, driftTimeout = time.Millisecond, time.Millisecond*10
+
+	api := &slowDriftAPI{}
+	d := &deployer{svc: api, helper: &cloudFormationHelper{api}}
+
+	if _, err := d.Drift("root"); err == nil || !strings.Contains(err.Error(), "did not complete") {
+		t.Errorf("Want drift detection to time out, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package deployer
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"sort"
+	"strings"
+)
+
+// OperationFailure is a resource that failed during the most recent operation
+// on a stack or one of its nested stacks
+type OperationFailure struct {
+	*cloudformation.StackEvent
+
+	// StackPath is the logical ID of the nested stack that holds the
+	// resource, prefixed by the logical IDs of its parent stacks and separated
+	// by dots. It is empty for resources of the root stack.
+	StackPath string
+}
+
+// FailedOperationError is returned when a stack operation does not reach the
+// desired state. It holds the resources that failed, oldest first, so that
+// the first of them is usually the root cause.
+type FailedOperationError struct {
+	Err      error
+	Failures []*OperationFailure
+}
+
+func (e *FailedOperationError) Error() string {
+	if len(e.Failures) == 0 {
+		return e.Err.Error()
+	}
+
+	lines := []string{
+		e.Err.Error(),
+		"",
+		"First failure: " + formatFailure(e.Failures[0]),
+	}
+
+	if len(e.Failures) > 1 {
+		lines = append(lines, "", "Other failures:")
+
+		for _, f := range e.Failures[1:] {
+			lines = append(lines, "  "+formatFailure(f))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatFailure describes a failure on a single line
+func formatFailure(f *OperationFailure) string {
+	stack := f.StackPath
+
+	if stack == "" {
+		stack = "(root stack)"
+	}
+
+	return fmt.Sprintf("%s %s (%s) %s: %s",
+		stack,
+		aws.StringValue(f.LogicalResourceId),
+		aws.StringValue(f.ResourceType),
+		aws.StringValue(f.ResourceStatus),
+		aws.StringValue(f.ResourceStatusReason))
+}
+
+// failedOperationError wraps err with the resources that failed during the
+// operation on the stack that was started with token, or the most recent
+// operation if token is empty. If the failures cannot be found, err is
+// returned unchanged.
+func (d *deployer) failedOperationError(stackID, token string, err error) error {
+	var (
+		evts []*cloudformation.StackEvent
+		ferr error
+	)
+
+	if token != "" {
+		evts, ferr = d.helper.OperationEvents(stackID, token)
+	} else {
+		evts, ferr = d.helper.EventsSince(stackID, events.IsOperationStart)
+	}
+
+	if ferr != nil {
+		return err
+	}
+
+	failures, ferr := d.operationFailures(evts, "")
+
+	if ferr != nil || len(failures) == 0 {
+		return err
+	}
+
+	sort.Stable(byFailureTime(failures))
+
+	return &FailedOperationError{Err: err, Failures: failures}
+}
+
+// operationFailures returns the resources that failed in the events of an
+// operation on a stack, including those in nested stacks. A failed nested
+// stack is replaced by the failures inside it. Failures that only report that
+// an operation was cancelled because another resource failed are ignored.
+func (d *deployer) operationFailures(evts []*cloudformation.StackEvent, stackPath string) ([]*OperationFailure, error) {
+	var failures []*OperationFailure
+
+	for _, e := range evts {
+		if events.IsStackEvent(e) || !strings.HasSuffix(aws.StringValue(e.ResourceStatus), "_FAILED") || isCancellation(e) {
+			continue
+		}
+
+		if aws.StringValue(e.ResourceType) == "AWS::CloudFormation::Stack" && aws.StringValue(e.PhysicalResourceId) != "" {
+			path := aws.StringValue(e.LogicalResourceId)
+
+			if stackPath != "" {
+				path = stackPath + "." + path
+			}
+
+			nestedEvents, err := d.helper.EventsSince(*e.PhysicalResourceId, nestedOperationStart(e))
+
+			if err != nil {
+				return nil, err
+			}
+
+			nested, err := d.operationFailures(nestedEvents, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if len(nested) > 0 {
+				failures = append(failures, nested...)
+				continue
+			}
+		}
+
+		failures = append(failures, &OperationFailure{StackEvent: e, StackPath: stackPath})
+	}
+
+	return failures, nil
+}
+
+// nestedOperationStart returns a function that matches the start of the
+// operation on a nested stack whose failure is reported by e. When the create
+// or update of a nested stack fails, the rollback of its parent may delete
+// it, so a delete only starts the operation if it was the delete that failed.
+func nestedOperationStart(e *cloudformation.StackEvent) func(*cloudformation.StackEvent) bool {
+	deleting := strings.HasPrefix(aws.StringValue(e.ResourceStatus), "DELETE_")
+
+	return func(n *cloudformation.StackEvent) bool {
+		return events.IsOperationStart(n) && (aws.StringValue(n.ResourceStatus) == cloudformation.ResourceStatusDeleteInProgress) == deleting
+	}
+}
+
+// isCancellation returns true if e reports that an operation on a resource was
+// cancelled, rather than that the resource itself failed
+func isCancellation(e *cloudformation.StackEvent) bool {
+	reason := aws.StringValue(e.ResourceStatusReason)
+	return strings.HasPrefix(reason, "Resource ") && strings.HasSuffix(reason, " cancelled")
+}
+
+// byFailureTime sorts failures from oldest to newest
+type byFailureTime []*OperationFailure
+
+func (a byFailureTime) Len() int      { return len(a) }
+func (a byFailureTime) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byFailureTime) Less(i, j int) bool {
+	return aws.TimeValue(a[i].Timestamp).Before(aws.TimeValue(a[j].Timestamp))
+}
@@ -0,0 +1,93 @@
+package deployer
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"strings"
+	"testing"
+)
+
+func failedEvent(stackID, logicalID, physicalID, resourceType, reason string, minute int) *cloudformation.StackEvent {
+	e := stackEvent(stackID, logicalID, physicalID, resourceType, "CREATE_FAILED", minute)
+	e.ResourceStatusReason = aws.String(reason)
+	return e
+}
+
+func TestFailedOperationError(t *testing.T) {
+	api := &stackEventsAPI{events: map[string][]*cloudformation.StackEvent{
+		"root": {
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "ROLLBACK_IN_PROGRESS", 9),
+			failedEvent("root", "Web", "web", "AWS::CloudFormation::Stack", "Embedded stack web was not successfully created", 8),
+			failedEvent("root", "Queue", "", "AWS::SQS::Queue", "Resource creation cancelled", 7),
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "CREATE_IN_PROGRESS", 1),
+			failedEvent("root", "Old", "", "AWS::SQS::Queue", "Failure of a previous operation", 0),
+		},
+		"web": {
+			failedEvent("web", "Listener", "", "AWS::ElasticLoadBalancingV2::Listener", "Resource creation cancelled", 6),
+			failedEvent("web", "LoadBalancer", "", "AWS::ElasticLoadBalancingV2::LoadBalancer", "Subnets are in the same availability zone", 5),
+			stackEvent("web", "web", "web", "AWS::CloudFormation::Stack", "CREATE_IN_PROGRESS", 2),
+		},
+	}}
+
+	d := &deployer{helper: &cloudFormationHelper{api}}
+	err := d.failedOperationError("root", "", errors.New("Unexpected stack status"))
+
+	failed, ok := err.(*FailedOperationError)
+
+	if !ok {
+		t.Fatalf("Want FailedOperationError, got %v", err)
+	}
+
+	if len(failed.Failures) != 1 {
+		t.Fatalf("Want 1 failure, got %d", len(failed.Failures))
+	}
+
+	want := "First failure: Web LoadBalancer (AWS::ElasticLoadBalancingV2::LoadBalancer) CREATE_FAILED: Subnets are in the same availability zone"
+
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("Want %s, got %s", want, err.Error())
+	}
+}
+
+func TestFailedOperationErrorOfDeletedStacks(t *testing.T) {
+	// the create of the root stack fails because its nested stack fails, so
+	// the nested stack is rolled back and deleted, and the root stack is
+	// deleted as well
+	api := &stackEventsAPI{events: map[string][]*cloudformation.StackEvent{
+		"root": append(withToken("deploy",
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "DELETE_COMPLETE", 12),
+			stackEvent("root", "Web", "web", "AWS::CloudFormation::Stack", "DELETE_COMPLETE", 11),
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "DELETE_IN_PROGRESS", 10),
+			failedEvent("root", "Web", "web", "AWS::CloudFormation::Stack", "Embedded stack web was not successfully created", 8),
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "CREATE_IN_PROGRESS", 1),
+		), withToken("previous",
+			failedEvent("root", "Old", "", "AWS::SQS::Queue", "Failure of a previous operation", 0),
+		)...),
+		"web": {
+			stackEvent("web", "web", "web", "AWS::CloudFormation::Stack", "DELETE_COMPLETE", 10),
+			stackEvent("web", "web", "web", "AWS::CloudFormation::Stack", "DELETE_IN_PROGRESS", 9),
+			failedEvent("web", "LoadBalancer", "", "AWS::ElasticLoadBalancingV2::LoadBalancer", "Subnets are in the same availability zone", 5),
+			stackEvent("web", "web", "web", "AWS::CloudFormation::Stack", "CREATE_IN_PROGRESS", 2),
+		},
+	}}
+
+	d := &deployer{helper: &cloudFormationHelper{api}}
+	err := d.failedOperationError("root", "deploy", errors.New("Unexpected stack status"))
+
+	failed, ok := err.(*FailedOperationError)
+
+	if !ok {
+		t.Fatalf("Want FailedOperationError, got %v", err)
+	}
+
+	if len(failed.Failures) != 1 {
+		t.Fatalf("Want 1 failure, got %d", len(failed.Failures))
+	}
+
+	want := "First failure: Web LoadBalancer (AWS::ElasticLoadBalancingV2::LoadBalancer) CREATE_FAILED: Subnets are in the same availability zone"
+
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("Want %s, got %s", want, err.Error())
+	}
+}
@@ -0,0 +1,87 @@
+package deployer
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/bernos/cfn-deploy/cfndeploy/history"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// newHistoryEntry builds the history entry of a deployment, holding the
+// checksum of each template and the parameters that will be sent
+func newHistoryEntry(options *DeployOptions, b *build, version string, params StackParams, start time.Time) (*history.Entry, error) {
+	entry := &history.Entry{
+		StackName:        options.StackName,
+		Version:          version,
+		Templates:        make(map[string]string),
+		Tags:             options.StackTags,
+		Caller:           options.Caller,
+		CfndeployVersion: options.CfndeployVersion,
+		GitCommit:        options.GitCommit,
+		Start:            start.UTC(),
+	}
+
+	basePath := filepath.Dir(b.mainTemplate)
+
+	for _, template := range b.templates {
+		data, err := ioutil.ReadFile(template)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rel, err := filepath.Rel(basePath, template)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Templates[filepath.ToSlash(rel)] = fmt.Sprintf("%x", sha1.Sum(data))
+	}
+
+	noEcho, err := readNoEchoParameters(b.mainTemplate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Parameters = maskNoEcho(params, noEcho)
+
+	return entry, nil
+}
+
+// recordHistory completes the history entry of a deployment with its final
+// status, and records it. Failing to record the entry does not fail the
+// deployment.
+func (d *deployer) recordHistory(options *DeployOptions, entry *history.Entry, stackID, desiredStatus string, err error) {
+	if d.h == nil {
+		return
+	}
+
+	entry.End = time.Now().UTC()
+
+	switch {
+	case err == nil:
+		entry.Status = desiredStatus
+	case stackID == "":
+		entry.Status = history.StatusNotStarted
+	default:
+		if stack, err := d.helper.DescribeStack(stackID); err == nil {
+			entry.Status = aws.StringValue(stack.StackStatus)
+		}
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	log.Printf("Recording deployment of version %s in history", entry.Version)
+
+	if err := d.h.Record(options.Bucket, options.BucketFolder, entry); err != nil {
+		log.Printf("Unable to record deployment in history: %s", err.Error())
+	}
+}
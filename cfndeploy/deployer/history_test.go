@@ -0,0 +1,82 @@
+package deployer
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/history"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const secretTemplate = `
+Parameters:
+  Password:
+    Type: String
+    NoEcho: true
+  Env:
+    Type: String
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+`
+
+func TestNewHistoryEntry(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cfndeploy")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer os.RemoveAll(folder)
+
+	if err := ioutil.WriteFile(filepath.Join(folder, "Stack.yaml"), []byte(secretTemplate), 0644); err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	b, err := newBuild(folder, filepath.Join(folder, "Stack.yaml"), nil)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer b.Close()
+
+	options := &DeployOptions{
+		StackName: "stack",
+		StackTags: StackTags{"Team": "web"},
+		GitCommit: "abc123",
+	}
+
+	params := StackParams{"Password": "secret", "Env": "prod", "Version": "1234abcd"}
+	start := time.Now()
+
+	entry, err := newHistoryEntry(options, b, "1234abcd", params, start)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	wantParams := map[string]string{"Password": history.MaskedValue, "Env": "prod", "Version": "1234abcd"}
+
+	if !reflect.DeepEqual(entry.Parameters, wantParams) {
+		t.Errorf("Want parameters %v, got %v", wantParams, entry.Parameters)
+	}
+
+	wantTemplates := map[string]string{"Stack.yaml": fmt.Sprintf("%x", sha1.Sum([]byte(secretTemplate)))}
+
+	if !reflect.DeepEqual(entry.Templates, wantTemplates) {
+		t.Errorf("Want templates %v, got %v", wantTemplates, entry.Templates)
+	}
+
+	if entry.StackName != "stack" || entry.Version != "1234abcd" || entry.GitCommit != "abc123" || !entry.Start.Equal(start) {
+		t.Errorf("Incomplete entry %#v", entry)
+	}
+
+	if params["Password"] != "secret" {
+		t.Errorf("Want params unchanged, got %v", params)
+	}
+}
@@ -0,0 +1,237 @@
+package deployer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// includeKey is the key of the include directive. An object holding only the
+// directive is replaced by the fragment it refers to. An object holding other
+// keys as well is merged with the fragment, which must then be an object, and
+// its own keys take precedence. In an array, a fragment that is itself an
+// array is spliced into the array.
+const includeKey = "cfndeploy::Include"
+
+// includeResolver resolves the include directives of a template
+type includeResolver struct {
+	b *build
+
+	// staged maps the source of each staged template, without any .tmpl
+	// suffix, to the staged file, so that rendered fragments are included
+	staged map[string]string
+
+	// fragments holds the absolute paths of all included fragments
+	fragments map[string]bool
+}
+
+// resolveIncludes replaces the include directives in the staged JSON and YAML
+// templates with the fragments they refer to. Templates that include
+// fragments are written as JSON. Fragments are no longer treated as
+// templates, so they are neither validated nor uploaded.
+func (b *build) resolveIncludes() error {
+	r := &includeResolver{
+		b:         b,
+		staged:    make(map[string]string),
+		fragments: make(map[string]bool),
+	}
+
+	for staged, source := range b.sources {
+		abs, err := filepath.Abs(strings.TrimSuffix(source, templateSuffix))
+
+		if err != nil {
+			return err
+		}
+
+		r.staged[abs] = staged
+	}
+
+	for _, template := range b.templates {
+		doc, ok, err := readTemplate(template)
+
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		source, err := filepath.Abs(strings.TrimSuffix(b.sources[template], templateSuffix))
+
+		if err != nil {
+			return err
+		}
+
+		resolved, included, err := r.resolve(doc, []string{source})
+
+		if err != nil {
+			return err
+		}
+
+		if included {
+			if err := writeJSONTemplate(template, resolved.(map[string]interface{})); err != nil {
+				return err
+			}
+		}
+	}
+
+	var templates []string
+
+	for _, template := range b.templates {
+		source, err := filepath.Abs(strings.TrimSuffix(b.sources[template], templateSuffix))
+
+		if err != nil {
+			return err
+		}
+
+		if !r.fragments[source] {
+			templates = append(templates, template)
+		}
+	}
+
+	b.templates = templates
+
+	return nil
+}
+
+// resolve replaces the include directives in value. chain holds the files
+// being included, the last of which holds value. It returns true if any
+// fragment was included.
+func (r *includeResolver) resolve(value interface{}, chain []string) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if _, ok := v[includeKey]; ok {
+			return r.include(v, chain)
+		}
+
+		included := false
+
+		for key, child := range v {
+			resolved, ok, err := r.resolve(child, chain)
+
+			if err != nil {
+				return nil, false, err
+			}
+
+			v[key] = resolved
+			included = included || ok
+		}
+
+		return v, included, nil
+
+	case []interface{}:
+		var (
+			items    []interface{}
+			included bool
+		)
+
+		for _, child := range v {
+			resolved, ok, err := r.resolve(child, chain)
+
+			if err != nil {
+				return nil, false, err
+			}
+
+			if fragment, isArray := resolved.([]interface{}); isArray && isIncludeOnly(child) {
+				items = append(items, fragment...)
+			} else {
+				items = append(items, resolved)
+			}
+
+			included = included || ok
+		}
+
+		return items, included, nil
+	}
+
+	return value, false, nil
+}
+
+// include replaces or merges the include directive in value with the fragment
+// it refers to
+func (r *includeResolver) include(value map[string]interface{}, chain []string) (interface{}, bool, error) {
+	current := chain[len(chain)-1]
+	name, ok := value[includeKey].(string)
+
+	if !ok || name == "" {
+		return nil, false, fmt.Errorf("Invalid %s in %s. Expected the path of a fragment", includeKey, current)
+	}
+
+	file := name
+
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(filepath.Dir(current), file)
+	}
+
+	for _, f := range chain {
+		if f == file {
+			return nil, false, fmt.Errorf("Include cycle: %s", strings.Join(append(chain, file), " -> "))
+		}
+	}
+
+	fragment, err := r.readFragment(file)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("Unable to include %s in %s: %s", name, current, err.Error())
+	}
+
+	r.fragments[file] = true
+
+	if fragment, _, err = r.resolve(fragment, append(chain, file)); err != nil {
+		return nil, false, err
+	}
+
+	if len(value) == 1 {
+		return fragment, true, nil
+	}
+
+	merged, ok := fragment.(map[string]interface{})
+
+	if !ok {
+		return nil, false, fmt.Errorf("Unable to merge %s into %s. Only objects can be merged", name, current)
+	}
+
+	for key, child := range value {
+		if key == includeKey {
+			continue
+		}
+
+		resolved, _, err := r.resolve(child, chain)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		merged[key] = resolved
+	}
+
+	return merged, true, nil
+}
+
+// readFragment reads a JSON or YAML fragment. The staged copy of the fragment
+// is read if there is one, so that fragments may themselves be rendered.
+func (r *includeResolver) readFragment(file string) (interface{}, error) {
+	name := file
+
+	if staged, ok := r.staged[file]; ok {
+		name = staged
+	}
+
+	buf, err := ioutil.ReadFile(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTemplateBody(buf)
+}
+
+// isIncludeOnly returns true if value is an object holding only an include
+// directive
+func isIncludeOnly(value interface{}) bool {
+	m, ok := value.(map[string]interface{})
+	_, include := m[includeKey]
+	return ok && include && len(m) == 1
+}
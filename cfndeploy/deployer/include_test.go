@@ -0,0 +1,134 @@
+package deployer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveIncludes(t *testing.T) {
+	folder := "./test-fixtures/templates/include"
+
+	b, err := newBuild(folder, filepath.Join(folder, "Stack.json"), nil)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer b.Close()
+
+	if want := []string{b.mainTemplate}; !reflect.DeepEqual(b.templates, want) {
+		t.Errorf("Want templates %v, got %v", want, b.templates)
+	}
+
+	doc, err := readJSONTemplate(b.mainTemplate)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	resources := doc["Resources"].(map[string]interface{})
+
+	want := map[string]interface{}{
+		"LogGroup": map[string]interface{}{
+			"Type": "AWS::Logs::LogGroup",
+			"Properties": map[string]interface{}{
+				"RetentionInDays": json.Number("14"),
+			},
+		},
+		"Queue": map[string]interface{}{
+			"Type": "AWS::SQS::Queue",
+			"Properties": map[string]interface{}{
+				"MessageRetentionPeriod": json.Number("1209600"),
+				"VisibilityTimeout":      json.Number("60"),
+				"Tags": []interface{}{
+					map[string]interface{}{"Key": "Name", "Value": "queue"},
+					map[string]interface{}{"Key": "Team", "Value": "platform"},
+					map[string]interface{}{"Key": "Owner", "Value": "ops"},
+				},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(resources, want) {
+		t.Errorf("Want %v, got %v", want, resources)
+	}
+}
+
+func TestResolveIncludesCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfndeploy-test")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"Stack.json": `{"Resources": {"cfndeploy::Include": "a.json"}}`,
+		"a.json":     `{"A": {"cfndeploy::Include": "b.json"}}`,
+		"b.json":     `{"B": {"cfndeploy::Include": "a.json"}}`,
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+	}
+
+	_, err = newBuild(dir, filepath.Join(dir, "Stack.json"), nil)
+
+	if err == nil || !strings.Contains(err.Error(), "Include cycle") {
+		t.Errorf("Want include cycle error, got %v", err)
+	}
+}
+
+func TestResolveIncludesOfYAMLTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfndeploy-test")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"Stack.yaml": "Resources:\n  Queue:\n    Type: AWS::SQS::Queue\n    Properties:\n      cfndeploy::Include: queue.json\n      QueueName: !Ref AWS::StackName\n",
+		"queue.json": `{"VisibilityTimeout": 60}`,
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+	}
+
+	b, err := newBuild(dir, filepath.Join(dir, "Stack.yaml"), nil)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer b.Close()
+
+	doc, err := readJSONTemplate(b.mainTemplate)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	properties := doc["Resources"].(map[string]interface{})["Queue"].(map[string]interface{})["Properties"]
+
+	want := map[string]interface{}{
+		"VisibilityTimeout": json.Number("60"),
+		"QueueName":         map[string]interface{}{"Ref": "AWS::StackName"},
+	}
+
+	if !reflect.DeepEqual(properties, want) {
+		t.Errorf("Want %v, got %v", want, properties)
+	}
+}
@@ -1,8 +1,11 @@
 package deployer
 
 import (
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/bernos/cfn-deploy/cfndeploy/history"
+	"time"
 )
 
 // DeployOptions holds options for template deployment
@@ -15,14 +18,217 @@ type DeployOptions struct {
 	BucketFolder   string
 	StackParams    StackParams
 	StackTags      StackTags
+	ServiceRoleARN string
+
+	// NotificationARNs are the SNS topics that stack events are sent to. If
+	// nil, the topics of an existing stack are left unchanged, and if empty
+	// they are removed.
+	NotificationARNs []string
+
+	TimeoutInMinutes int64
+	OnFailure        string
+	DisableRollback  bool
+
+	// TerminationProtection enables or disables termination protection. If
+	// nil, termination protection is left unchanged.
+	TerminationProtection *bool
+
+	// ClientRequestToken identifies the stack operation, so that retried
+	// calls are not performed twice. If empty, a token that is unique to the
+	// deployment is generated from the stack name, template version and the
+	// time the deployment started.
+	ClientRequestToken string
+
+	// StackPolicy is the body of the stack policy to apply to the stack
+	StackPolicy string
+
+	// StackPolicyDuringUpdate is the body of a policy that temporarily
+	// overrides the stack policy while the stack is updated
+	StackPolicyDuringUpdate string
+
+	// RollbackConfiguration holds alarms that trigger a rollback if they go
+	// into alarm during or after the stack operation
+	RollbackConfiguration *RollbackConfiguration
+
+	// ProtectedResourceTypes are the resource types that an update may not
+	// remove or replace. If nil, DefaultProtectedResourceTypes are used.
+	ProtectedResourceTypes []string
+
+	// AllowReplace holds logical IDs, or dot separated paths for resources in
+	// nested stacks, of protected resources that may be removed or replaced
+	AllowReplace []string
+
+	// AllowDestructive allows any protected resource to be removed or replaced
+	AllowDestructive bool
+
+	// WaitTimeout is the maximum time to wait for an operation that is
+	// already in progress on the stack to finish, before deploying
+	WaitTimeout time.Duration
+
+	// Lock enables the deployment lock, which prevents concurrent deployments
+	// of the same stack. The lock is stored in the template bucket.
+	Lock bool
+
+	// LockOwner identifies who holds the lock
+	LockOwner string
+
+	// LockTTL is the time after which a lock is considered stale, and may be
+	// taken over by another deployment
+	LockTTL time.Duration
+
+	// LockTimeout is the maximum time to wait for a lock held by another
+	// deployment
+	LockTimeout time.Duration
+
+	// TemplateVars are the variables that templates ending in .tmpl are
+	// rendered with
+	TemplateVars TemplateVars
+
+	// Approve is called with a preview of the changes before the stack is
+	// created or updated. The deployment is cancelled if it returns false.
+	Approve func(*Preview) (bool, error)
+
+	// Caller, CfndeployVersion and GitCommit are recorded in the deployment
+	// history
+	Caller           *history.Caller
+	CfndeployVersion string
+	GitCommit        string
 }
 
 // Validate returns an error if the options are not valid
 func (o *DeployOptions) Validate() error {
-	// TODO: implement me
+	if o.Lock && o.LockTTL <= 0 {
+		return fmt.Errorf("Lock TTL must be positive")
+	}
+
+	if o.WaitTimeout < 0 {
+		return fmt.Errorf("Wait timeout must not be negative")
+	}
+
+	if o.TimeoutInMinutes < 0 {
+		return fmt.Errorf("Timeout must not be negative")
+	}
+
+	switch o.OnFailure {
+	case "",
+		cloudformation.OnFailureRollback,
+		cloudformation.OnFailureDelete,
+		cloudformation.OnFailureDoNothing:
+	default:
+		return fmt.Errorf("Invalid OnFailure value '%s'. Expected one of %s, %s or %s", o.OnFailure,
+			cloudformation.OnFailureRollback, cloudformation.OnFailureDelete, cloudformation.OnFailureDoNothing)
+	}
+
+	if o.OnFailure != "" && o.DisableRollback {
+		return fmt.Errorf("OnFailure and DisableRollback cannot both be set")
+	}
+
+	if err := o.RollbackConfiguration.Validate(); err != nil {
+		return err
+	}
+
+	if o.StackPolicy != "" {
+		if err := validateStackPolicy(o.StackPolicy); err != nil {
+			return fmt.Errorf("Invalid stack policy: %s", err.Error())
+		}
+	}
+
+	if o.StackPolicyDuringUpdate != "" {
+		if err := validateStackPolicy(o.StackPolicyDuringUpdate); err != nil {
+			return fmt.Errorf("Invalid stack policy during update: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// ContinueUpdateRollbackOptions holds options for continuing the rollback of
+// a stack that failed to roll back
+type ContinueUpdateRollbackOptions struct {
+	StackName string
+
+	// ResourcesToSkip holds the logical IDs of resources that should not be
+	// rolled back. Resources in nested stacks are given as
+	// NestedStack.LogicalId
+	ResourcesToSkip []string
+
+	ServiceRoleARN string
+}
+
+// DeleteOptions holds options for deleting a stack
+type DeleteOptions struct {
+	StackName string
+
+	// RetainResources holds the logical IDs of resources that are kept when
+	// the stack is deleted. Only resources that failed to delete may be
+	// retained.
+	RetainResources []string
+
+	ServiceRoleARN string
+}
+
+// EventsOptions holds options for showing the events of a stack
+type EventsOptions struct {
+	StackName string
+
+	// Follow keeps showing events until the operation in progress finishes
+	Follow bool
+
+	// Timeout is the maximum time to follow an operation
+	Timeout time.Duration
+}
+
+// RollbackConfiguration holds the cloudwatch alarms that cloudformation
+// monitors during a stack operation, and for the monitoring period after it
+type RollbackConfiguration struct {
+	AlarmARNs        []string
+	MonitoringPeriod time.Duration
+}
+
+// Validate returns an error if the rollback configuration is not valid
+func (r *RollbackConfiguration) Validate() error {
+	if r == nil {
+		return nil
+	}
+
+	if r.MonitoringPeriod < 0 || r.MonitoringPeriod > time.Minute*180 {
+		return fmt.Errorf("Rollback monitoring period must be between 0 and 180 minutes")
+	}
+
+	if r.MonitoringPeriod%time.Minute != 0 {
+		return fmt.Errorf("Rollback monitoring period must be a whole number of minutes")
+	}
+
+	if len(r.AlarmARNs) > 5 {
+		return fmt.Errorf("At most 5 rollback alarms may be given")
+	}
+
 	return nil
 }
 
+// AWSRollbackConfiguration converts RollbackConfiguration to a
+// *cloudformation.RollbackConfiguration
+func (r *RollbackConfiguration) AWSRollbackConfiguration() *cloudformation.RollbackConfiguration {
+	config := &cloudformation.RollbackConfiguration{
+		MonitoringTimeInMinutes: aws.Int64(int64(r.MonitoringPeriod / time.Minute)),
+		RollbackTriggers:        []*cloudformation.RollbackTrigger{},
+	}
+
+	for _, arn := range r.AlarmARNs {
+		config.RollbackTriggers = append(config.RollbackTriggers, &cloudformation.RollbackTrigger{
+			Arn:  aws.String(arn),
+			Type: aws.String("AWS::CloudWatch::Alarm"),
+		})
+	}
+
+	return config
+}
+
+// hasTriggers returns true if any rollback alarms are configured
+func (r *RollbackConfiguration) hasTriggers() bool {
+	return r != nil && len(r.AlarmARNs) > 0
+}
+
 // StackParams holds parameters for a cloudforamtion stack
 type StackParams map[string]string
 
@@ -56,3 +262,18 @@ func (t StackTags) AWSTags() []*cloudformation.Tag {
 
 	return tags
 }
+
+// PullOptions holds options for exporting a deployed stack to a template
+// folder
+type PullOptions struct {
+	StackName string
+
+	// TemplateFolder is the folder the templates are written to
+	TemplateFolder string
+
+	// MainTemplate is the file name of the main template
+	MainTemplate string
+
+	// Overwrite allows existing templates in the folder to be replaced
+	Overwrite bool
+}
@@ -1,7 +1,9 @@
 package deployer
 
 import (
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"testing"
+	"time"
 )
 
 func TestStackParamsAsAWSParams(t *testing.T) {
@@ -22,3 +24,56 @@ func TestStackParamsAsAWSParams(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateDeployOptions(t *testing.T) {
+	tests := []struct {
+		options *DeployOptions
+		valid   bool
+	}{
+		{&DeployOptions{}, true},
+		{&DeployOptions{OnFailure: cloudformation.OnFailureDelete}, true},
+		{&DeployOptions{DisableRollback: true}, true},
+		{&DeployOptions{OnFailure: "EXPLODE"}, false},
+		{&DeployOptions{OnFailure: cloudformation.OnFailureRollback, DisableRollback: true}, false},
+		{&DeployOptions{TimeoutInMinutes: -1}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.options.Validate()
+
+		if tt.valid && err != nil {
+			t.Errorf("Want valid, got %s", err.Error())
+		}
+
+		if !tt.valid && err == nil {
+			t.Errorf("Want error, got valid for %#v", tt.options)
+		}
+	}
+}
+
+func TestRollbackConfigurationAsAWSRollbackConfiguration(t *testing.T) {
+	r := &RollbackConfiguration{
+		AlarmARNs:        []string{"arn:aws:cloudwatch:ap-southeast-2:123456789012:alarm:errors"},
+		MonitoringPeriod: time.Minute * 15,
+	}
+
+	if err := r.Validate(); err != nil {
+		t.Errorf("Error: %s", err.Error())
+	}
+
+	config := r.AWSRollbackConfiguration()
+
+	if *config.MonitoringTimeInMinutes != 15 {
+		t.Errorf("Want %d, got %d", 15, *config.MonitoringTimeInMinutes)
+	}
+
+	if len(config.RollbackTriggers) != 1 || *config.RollbackTriggers[0].Arn != r.AlarmARNs[0] {
+		t.Errorf("Want trigger for %s, got %v", r.AlarmARNs[0], config.RollbackTriggers)
+	}
+
+	r.MonitoringPeriod = time.Second * 90
+
+	if err := r.Validate(); err == nil {
+		t.Errorf("Want error for partial minutes, got valid")
+	}
+}
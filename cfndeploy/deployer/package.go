@@ -0,0 +1,519 @@
+package deployer
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// locationFormat is the way a resource property refers to an S3 object
+type locationFormat int
+
+const (
+	// s3URI is a string of the form s3://bucket/key
+	s3URI locationFormat = iota
+
+	// s3BucketKey is an object with S3Bucket and S3Key properties
+	s3BucketKey
+
+	// bucketKey is an object with Bucket and Key properties
+	bucketKey
+)
+
+// packageableProperty is a resource property that may refer to a local file
+// or directory, which is uploaded to S3 when packaging
+type packageableProperty struct {
+	resourceType string
+	property     string
+	location     locationFormat
+
+	// zip is true if files that are not already zip or jar archives must be
+	// zipped. Directories are always zipped.
+	zip bool
+}
+
+var (
+	packageableProperties = []packageableProperty{
+		{"AWS::Lambda::Function", "Code", s3BucketKey, true},
+		{"AWS::Lambda::LayerVersion", "Content", s3BucketKey, true},
+		{"AWS::Serverless::Function", "CodeUri", s3URI, true},
+		{"AWS::Serverless::LayerVersion", "ContentUri", s3URI, true},
+		{"AWS::Serverless::Api", "DefinitionUri", s3URI, false},
+		{"AWS::Serverless::HttpApi", "DefinitionUri", s3URI, false},
+		{"AWS::Serverless::StateMachine", "DefinitionUri", s3URI, false},
+		{"AWS::ApiGateway::RestApi", "BodyS3Location", bucketKey, false},
+		{"AWS::StepFunctions::StateMachine", "DefinitionS3Location", bucketKey, false},
+		{"AWS::AppSync::GraphQLSchema", "DefinitionS3Location", s3URI, false},
+		{"AWS::AppSync::Resolver", "RequestMappingTemplateS3Location", s3URI, false},
+		{"AWS::AppSync::Resolver", "ResponseMappingTemplateS3Location", s3URI, false},
+		{"AWS::ElasticBeanstalk::ApplicationVersion", "SourceBundle", s3BucketKey, true},
+	}
+
+	// zipModified is the modification time of every file in a packaged zip,
+	// so that packaging the same files always produces the same zip
+	zipModified = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// artifact is a local file or directory that is uploaded to S3 in place of
+// the template properties that refer to it
+type artifact struct {
+	// source is the local file or directory
+	source string
+
+	// file is the file that is uploaded, which is either source or a zip of
+	// source
+	file string
+
+	// name is the name of the uploaded artifact, which is derived from the
+	// content of file so that unchanged artifacts keep the same name
+	name string
+
+	refs []*artifactRef
+}
+
+// artifactName returns the name of an uploaded artifact, which is derived
+// from the content of file
+func artifactName(file string) (string, error) {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	hash := sha1.New()
+
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x%s", hash.Sum(nil), filepath.Ext(file)), nil
+}
+
+// artifactRef is a resource property that refers to an artifact
+type artifactRef struct {
+	template   string
+	properties map[string]interface{}
+	property   packageableProperty
+}
+
+// packagedTemplate is a staged template that refers to artifacts
+type packagedTemplate struct {
+	file string
+	doc  map[string]interface{}
+}
+
+// packageArtifacts finds the resource properties in the staged JSON and YAML
+// templates that refer to local files or directories, and packages each of
+// them. Packaged templates are written as JSON. Staged files that are part of
+// an artifact are no longer treated as templates.
+func (b *build) packageArtifacts() ([]*packagedTemplate, error) {
+	var (
+		packaged  []*packagedTemplate
+		artifacts = make(map[string]*artifact)
+	)
+
+	for _, template := range b.templates {
+		doc, ok, err := readTemplate(template)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		refs := findArtifactRefs(template, doc, filepath.Dir(b.sources[template]), artifacts)
+
+		if refs > 0 {
+			packaged = append(packaged, &packagedTemplate{file: template, doc: doc})
+		}
+	}
+
+	if len(artifacts) == 0 {
+		return nil, nil
+	}
+
+	var sources []string
+
+	for source := range artifacts {
+		sources = append(sources, source)
+	}
+
+	sort.Strings(sources)
+
+	for i, source := range sources {
+		a := artifacts[source]
+
+		log.Printf("Packaging %s", source)
+
+		if err := a.build(filepath.Join(b.artifactDir, fmt.Sprintf("%d", i))); err != nil {
+			return nil, err
+		}
+
+		b.artifacts = append(b.artifacts, a)
+	}
+
+	b.excludeArtifactSources()
+
+	return packaged, nil
+}
+
+// packageTemplates packages the artifacts of the staged templates, and points
+// the properties that refer to them at the keys they are uploaded to when the
+// templates are deployed to the stack. It returns the version of the
+// templates, and the key prefix of the deployment in the bucket.
+func (b *build) packageTemplates(options *DeployOptions) (version, bucketPrefix string, err error) {
+	packaged, err := b.packageArtifacts()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if version, err = checksumTemplates(b.files()); err != nil {
+		return "", "", err
+	}
+
+	bucketPrefix = calculateBucketPrefix(options.StackName, options.BucketFolder, version)
+
+	if len(b.artifacts) == 0 {
+		return version, bucketPrefix, nil
+	}
+
+	if options.Bucket == "" {
+		return "", "", fmt.Errorf("A bucket is required to package the local artifacts of the templates")
+	}
+
+	if err := b.rewriteArtifactLocations(packaged, options.Bucket, path.Join(bucketPrefix, "artifacts")); err != nil {
+		return "", "", err
+	}
+
+	return version, bucketPrefix, nil
+}
+
+// excludeArtifactSources removes any staged template whose source is part of
+// an artifact
+func (b *build) excludeArtifactSources() {
+	var templates []string
+
+	for _, template := range b.templates {
+		if !b.isArtifactSource(b.sources[template]) {
+			templates = append(templates, template)
+		}
+	}
+
+	b.templates = templates
+}
+
+// isArtifactSource returns true if file is, or is inside, the source of an
+// artifact
+func (b *build) isArtifactSource(file string) bool {
+	abs, err := filepath.Abs(file)
+
+	if err != nil {
+		return false
+	}
+
+	for _, a := range b.artifacts {
+		if abs == a.source || strings.HasPrefix(abs, a.source+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewriteArtifactLocations points every property that refers to an artifact
+// at its uploaded S3 object, and writes the packaged templates
+func (b *build) rewriteArtifactLocations(templates []*packagedTemplate, bucket, prefix string) error {
+	for _, a := range b.artifacts {
+		key := path.Join(prefix, a.name)
+
+		for _, ref := range a.refs {
+			ref.properties[ref.property.property] = s3Location(ref.property.location, bucket, key)
+		}
+	}
+
+	for _, t := range templates {
+		if err := writeJSONTemplate(t.file, t.doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uploadArtifacts uploads all packaged artifacts below prefix
+func (d *deployer) uploadArtifacts(artifacts []*artifact, bucket, prefix string) error {
+	for _, a := range artifacts {
+		if result := d.u.UploadFile(a.file, bucket, path.Join(prefix, a.name)); result.Error != nil {
+			return result.Error
+		}
+	}
+
+	return nil
+}
+
+// findArtifactRefs adds an artifact for each packageable property of the
+// resources in doc that refers to a local file or directory. Relative paths
+// are resolved against dir. It returns the number of properties found.
+func findArtifactRefs(template string, doc map[string]interface{}, dir string, artifacts map[string]*artifact) int {
+	resources, _ := doc["Resources"].(map[string]interface{})
+	count := 0
+
+	for _, r := range resources {
+		resource, ok := r.(map[string]interface{})
+
+		if !ok {
+			continue
+		}
+
+		resourceType, _ := resource["Type"].(string)
+		properties, _ := resource["Properties"].(map[string]interface{})
+
+		for _, p := range packageableProperties {
+			if p.resourceType != resourceType || properties == nil {
+				continue
+			}
+
+			source, ok := localPath(properties[p.property], dir)
+
+			if !ok {
+				continue
+			}
+
+			a, found := artifacts[source]
+
+			if !found {
+				a = &artifact{source: source}
+				artifacts[source] = a
+			}
+
+			a.refs = append(a.refs, &artifactRef{
+				template:   template,
+				properties: properties,
+				property:   p,
+			})
+
+			count++
+		}
+	}
+
+	return count
+}
+
+// localPath returns the absolute path of the local file or directory that
+// value refers to, if it is a string that is neither an S3 nor an HTTP URL,
+// and refers to a file or directory that exists
+func localPath(value interface{}, dir string) (string, bool) {
+	s, ok := value.(string)
+
+	if !ok || s == "" || strings.HasPrefix(s, "s3://") || strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return "", false
+	}
+
+	if !filepath.IsAbs(s) {
+		s = filepath.Join(dir, s)
+	}
+
+	abs, err := filepath.Abs(s)
+
+	if err != nil {
+		return "", false
+	}
+
+	if _, err := os.Stat(abs); err != nil {
+		return "", false
+	}
+
+	return abs, true
+}
+
+// s3Location builds the value of a property that refers to key in bucket
+func s3Location(format locationFormat, bucket, key string) interface{} {
+	switch format {
+	case s3BucketKey:
+		return map[string]interface{}{"S3Bucket": bucket, "S3Key": key}
+	case bucketKey:
+		return map[string]interface{}{"Bucket": bucket, "Key": key}
+	}
+	return fmt.Sprintf("s3://%s/%s", bucket, key)
+}
+
+// build prepares the file to upload for the artifact in dir, and names it.
+// Directories, and files that must be zipped, are zipped. Other files are
+// uploaded as is.
+func (a *artifact) build(dir string) error {
+	info, err := os.Stat(a.source)
+
+	if err != nil {
+		return err
+	}
+
+	zipRequired := info.IsDir()
+
+	for _, ref := range a.refs {
+		if ref.property.zip && !isArchive(a.source) {
+			zipRequired = true
+		}
+	}
+
+	a.file = a.source
+
+	if zipRequired {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		a.file = filepath.Join(dir, filepath.Base(a.source)+".zip")
+
+		if err := zipPath(a.source, a.file); err != nil {
+			return err
+		}
+	}
+
+	a.name, err = artifactName(a.file)
+
+	return err
+}
+
+// isArchive returns true if file is already a zip or jar archive
+func isArchive(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".zip" || ext == ".jar"
+}
+
+// zipPath writes a zip of src, which may be a file or a directory, to dst.
+// Entries are written in name order with fixed timestamps, so that zipping
+// the same files always produces the same zip.
+func zipPath(src, dst string) error {
+	info, err := os.Stat(src)
+
+	if err != nil {
+		return err
+	}
+
+	base := src
+	files := []string{src}
+
+	if info.IsDir() {
+		if files, err = findTemplates(src); err != nil {
+			return err
+		}
+	} else {
+		base = filepath.Dir(src)
+	}
+
+	sort.Strings(files)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	for _, file := range files {
+		if err := addZipEntry(w, base, file); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(dst, buf.Bytes(), 0644)
+}
+
+// addZipEntry adds file to the zip, named by its path relative to base
+func addZipEntry(w *zip.Writer, base, file string) error {
+	info, err := os.Stat(file)
+
+	if err != nil {
+		return err
+	}
+
+	name, err := filepath.Rel(base, file)
+
+	if err != nil {
+		return err
+	}
+
+	header := &zip.FileHeader{
+		Name:     filepath.ToSlash(name),
+		Method:   zip.Deflate,
+		Modified: zipModified,
+	}
+
+	mode := os.FileMode(0644)
+
+	if info.Mode()&0111 != 0 {
+		mode = 0755
+	}
+
+	header.SetMode(mode)
+
+	entry, err := w.CreateHeader(header)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = io.Copy(entry, f)
+
+	return err
+}
+
+// readJSONTemplate parses a JSON template, keeping numbers as they were
+// written
+func readJSONTemplate(file string) (map[string]interface{}, error) {
+	buf, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// writeJSONTemplate writes doc to file as indented JSON
+func writeJSONTemplate(file string, doc map[string]interface{}) error {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
@@ -0,0 +1,219 @@
+package deployer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPackageArtifacts(t *testing.T) {
+	folder := "./test-fixtures/templates/lambda"
+
+	b, err := newBuild(folder, filepath.Join(folder, "Stack.json"), nil)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer b.Close()
+
+	packaged, err := b.packageArtifacts()
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	if len(b.artifacts) != 1 {
+		t.Fatalf("Want 1 artifact, got %d", len(b.artifacts))
+	}
+
+	if want := []string{b.mainTemplate}; !reflect.DeepEqual(b.templates, want) {
+		t.Errorf("Want templates %v, got %v", want, b.templates)
+	}
+
+	if err := b.rewriteArtifactLocations(packaged, "bucket", "prefix"); err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	doc, err := readJSONTemplate(b.mainTemplate)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	name := b.artifacts[0].name
+	resources := doc["Resources"].(map[string]interface{})
+
+	tests := []struct {
+		resource string
+		want     map[string]interface{}
+	}{
+		{"Function", map[string]interface{}{"S3Bucket": "bucket", "S3Key": "prefix/" + name}},
+		{"Existing", map[string]interface{}{"S3Bucket": "bucket", "S3Key": "code.zip"}},
+	}
+
+	for _, tt := range tests {
+		got := resources[tt.resource].(map[string]interface{})["Properties"].(map[string]interface{})["Code"]
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Want %v, got %v", tt.want, got)
+		}
+	}
+
+	source, err := readJSONTemplate(filepath.Join(folder, "Stack.json"))
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	code := source["Resources"].(map[string]interface{})["Function"].(map[string]interface{})["Properties"].(map[string]interface{})["Code"]
+
+	if code != "src" {
+		t.Errorf("Want source template to be unchanged, got %v", code)
+	}
+}
+
+func TestPackageArtifactsOfYAMLTemplate(t *testing.T) {
+	folder := "./test-fixtures/templates/lambda-yaml"
+
+	b, err := newBuild(folder, filepath.Join(folder, "Stack.yaml"), nil)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer b.Close()
+
+	packaged, err := b.packageArtifacts()
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	if len(b.artifacts) != 1 {
+		t.Fatalf("Want 1 artifact, got %d", len(b.artifacts))
+	}
+
+	if err := b.rewriteArtifactLocations(packaged, "bucket", "prefix"); err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	doc, err := readJSONTemplate(b.mainTemplate)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	properties := doc["Resources"].(map[string]interface{})["Function"].(map[string]interface{})["Properties"].(map[string]interface{})
+
+	tests := []struct {
+		property string
+		want     interface{}
+	}{
+		{"Code", map[string]interface{}{"S3Bucket": "bucket", "S3Key": "prefix/" + b.artifacts[0].name}},
+		{"Runtime", map[string]interface{}{"Ref": "Runtime"}},
+	}
+
+	for _, tt := range tests {
+		if got := properties[tt.property]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Want %v, got %v", tt.want, got)
+		}
+	}
+}
+
+func TestReadTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfndeploy-test")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		file    string
+		body    string
+		wantOK  bool
+		wantErr bool
+	}{
+		{"Stack.json", `{"Resources": {}}`, true, false},
+		{"Stack.yaml", "Resources: {}", true, false},
+		{"Stack.yaml", "Resources: [", false, true},
+		{"index.js", "}; {", false, false},
+		{"README", "Some notes", false, false},
+	}
+
+	for _, tt := range tests {
+		file := filepath.Join(dir, tt.file)
+
+		if err := ioutil.WriteFile(file, []byte(tt.body), 0644); err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+
+		_, ok, err := readTemplate(file)
+
+		if ok != tt.wantOK || (err != nil) != tt.wantErr {
+			t.Errorf("Want %t and error %t for %s, got %t and %v", tt.wantOK, tt.wantErr, tt.body, ok, err)
+		}
+	}
+}
+
+func TestZipPathIsDeterministic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfndeploy-test")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	var checksums []string
+
+	for _, file := range []string{"first.zip", "second.zip"} {
+		zip := filepath.Join(dir, file)
+
+		if err := zipPath("./test-fixtures/templates/lambda/src", zip); err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+
+		checksum, err := checksumTemplates([]string{zip})
+
+		if err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+
+		checksums = append(checksums, checksum)
+
+		// a later modification time must not change the zip
+		now := zipModified.AddDate(40, 0, 0)
+		os.Chtimes("./test-fixtures/templates/lambda/src/index.js", now, now)
+	}
+
+	if checksums[0] != checksums[1] {
+		t.Errorf("Want %s, got %s", checksums[0], checksums[1])
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	dir := "./test-fixtures/templates/lambda"
+
+	tests := []struct {
+		value interface{}
+		want  bool
+	}{
+		{"src", true},
+		{"src/index.js", true},
+		{"missing", false},
+		{"s3://bucket/key", false},
+		{"https://example.com/code.zip", false},
+		{map[string]interface{}{"S3Bucket": "bucket"}, false},
+	}
+
+	for _, tt := range tests {
+		if _, got := localPath(tt.value, dir); got != tt.want {
+			t.Errorf("Want %t, got %t for %v", tt.want, got, tt.value)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package deployer
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Plan describes the changes a deployment would make to a stack
+type Plan struct {
+	StackName string
+	Exists    bool
+	Settings  []SettingChange
+}
+
+// SettingChange is a difference between a setting of the live stack and the
+// setting that would be deployed
+type SettingChange struct {
+	Name    string
+	Current string
+	Desired string
+
+	// CreateOnly is true if the setting can only be applied when a stack is
+	// created, so will not be changed by an update
+	CreateOnly bool
+}
+
+// Plan returns the changes that deploying with the given options would make
+func (d *deployer) Plan(options *DeployOptions) (*Plan, error) {
+	plan := &Plan{
+		StackName: options.StackName,
+	}
+
+	exists, err := d.helper.StackExists(options.StackName)
+
+	if err != nil || !exists {
+		return plan, err
+	}
+
+	stack, err := d.helper.DescribeStack(options.StackName)
+
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Exists = true
+	plan.Settings = diffStackSettings(stack, options)
+
+	return plan, nil
+}
+
+// diffStackSettings compares the settings of stack with those given in
+// options. Settings that are not given in options are left unchanged by a
+// deployment, so are not compared.
+func diffStackSettings(stack *cloudformation.Stack, options *DeployOptions) []SettingChange {
+	var changes []SettingChange
+
+	add := func(name, current, desired string, createOnly bool) {
+		if current != desired {
+			changes = append(changes, SettingChange{
+				Name:       name,
+				Current:    current,
+				Desired:    desired,
+				CreateOnly: createOnly,
+			})
+		}
+	}
+
+	if options.ServiceRoleARN != "" {
+		add("RoleARN", aws.StringValue(stack.RoleARN), options.ServiceRoleARN, false)
+	}
+
+	if options.NotificationARNs != nil {
+		add("NotificationARNs", joinSorted(aws.StringValueSlice(stack.NotificationARNs)), joinSorted(options.NotificationARNs), false)
+	}
+
+	if options.TimeoutInMinutes > 0 {
+		add("TimeoutInMinutes", fmt.Sprint(aws.Int64Value(stack.TimeoutInMinutes)), fmt.Sprint(options.TimeoutInMinutes), true)
+	}
+
+	if options.OnFailure != "" || options.DisableRollback {
+		disable := options.DisableRollback || options.OnFailure == cloudformation.OnFailureDoNothing
+		add("DisableRollback", fmt.Sprint(aws.BoolValue(stack.DisableRollback)), fmt.Sprint(disable), true)
+	}
+
+	if r := options.RollbackConfiguration; r != nil {
+		var current []string
+		var minutes int64
+
+		if stack.RollbackConfiguration != nil {
+			for _, t := range stack.RollbackConfiguration.RollbackTriggers {
+				current = append(current, aws.StringValue(t.Arn))
+			}
+			minutes = aws.Int64Value(stack.RollbackConfiguration.MonitoringTimeInMinutes)
+		}
+
+		add("RollbackTriggers", joinSorted(current), joinSorted(r.AlarmARNs), false)
+		add("MonitoringTimeInMinutes", fmt.Sprint(minutes), fmt.Sprint(int64(r.MonitoringPeriod/time.Minute)), false)
+	}
+
+	if options.TerminationProtection != nil {
+		add("EnableTerminationProtection", fmt.Sprint(aws.BoolValue(stack.EnableTerminationProtection)), fmt.Sprint(*options.TerminationProtection), false)
+	}
+
+	return changes
+}
+
+// joinSorted returns a sorted, comma separated list of values
+func joinSorted(values []string) string {
+	sorted := make([]string, len(values))
+	copy(sorted, values)
+	sort.Strings(sorted)
+
+	return strings.Join(sorted, ",")
+}
@@ -0,0 +1,43 @@
+package deployer
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"testing"
+)
+
+func TestDiffStackSettings(t *testing.T) {
+	stack := &cloudformation.Stack{
+		RoleARN:                     aws.String("arn:aws:iam::123456789012:role/old"),
+		NotificationARNs:            aws.StringSlice([]string{"arn:b", "arn:a"}),
+		TimeoutInMinutes:            aws.Int64(30),
+		EnableTerminationProtection: aws.Bool(true),
+	}
+
+	tests := []struct {
+		options *DeployOptions
+		want    []string
+	}{
+		{&DeployOptions{}, nil},
+		{&DeployOptions{NotificationARNs: []string{"arn:a", "arn:b"}, TimeoutInMinutes: 30}, nil},
+		{&DeployOptions{ServiceRoleARN: "arn:aws:iam::123456789012:role/new"}, []string{"RoleARN"}},
+		{&DeployOptions{NotificationARNs: []string{}}, []string{"NotificationARNs"}},
+		{&DeployOptions{TimeoutInMinutes: 60, DisableRollback: true}, []string{"TimeoutInMinutes", "DisableRollback"}},
+		{&DeployOptions{OnFailure: cloudformation.OnFailureDelete, TerminationProtection: aws.Bool(false)}, []string{"EnableTerminationProtection"}},
+	}
+
+	for _, tt := range tests {
+		got := diffStackSettings(stack, tt.options)
+
+		if len(got) != len(tt.want) {
+			t.Errorf("Incorrect length. Want %d, got %d", len(tt.want), len(got))
+			continue
+		}
+
+		for i := range got {
+			if got[i].Name != tt.want[i] {
+				t.Errorf("Want %s, got %s", tt.want[i], got[i].Name)
+			}
+		}
+	}
+}
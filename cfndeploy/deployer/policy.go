@@ -0,0 +1,115 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"io/ioutil"
+)
+
+// LoadStackPolicy reads a stack policy from file, and returns an error if it
+// is not a valid stack policy
+func LoadStackPolicy(file string) (string, error) {
+	buf, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := validateStackPolicy(string(buf)); err != nil {
+		return "", fmt.Errorf("Invalid stack policy %s: %s", file, err.Error())
+	}
+
+	return string(buf), nil
+}
+
+// StackPolicy returns the stack policy of the named stack, or an empty string
+// if the stack has no policy
+func (d *deployer) StackPolicy(stackName string) (string, error) {
+	resp, err := d.svc.GetStackPolicy(&cloudformation.GetStackPolicyInput{
+		StackName: aws.String(stackName),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(resp.StackPolicyBody), nil
+}
+
+// SetStackPolicy sets the stack policy of the named stack
+func (d *deployer) SetStackPolicy(stackName, policy string) error {
+	if err := validateStackPolicy(policy); err != nil {
+		return err
+	}
+
+	_, err := d.svc.SetStackPolicy(&cloudformation.SetStackPolicyInput{
+		StackName:       aws.String(stackName),
+		StackPolicyBody: aws.String(policy),
+	})
+
+	return err
+}
+
+// stackPolicy is the structure of a cloudformation stack policy
+type stackPolicy struct {
+	Statement []struct {
+		Effect    string
+		Action    interface{}
+		NotAction interface{}
+	}
+}
+
+// validateStackPolicy returns an error if policy is not a JSON stack policy
+// with at least one statement, or if any statement is missing its effect or
+// actions
+func validateStackPolicy(policy string) error {
+	var p stackPolicy
+
+	if err := json.Unmarshal([]byte(policy), &p); err != nil {
+		return err
+	}
+
+	if len(p.Statement) == 0 {
+		return fmt.Errorf("Policy has no Statement entries")
+	}
+
+	for i, s := range p.Statement {
+		if s.Effect != "Allow" && s.Effect != "Deny" {
+			return fmt.Errorf("Statement %d has invalid Effect '%s'. Expected Allow or Deny", i, s.Effect)
+		}
+
+		action := s.Action
+
+		if action == nil {
+			action = s.NotAction
+		}
+
+		if !validPolicyAction(action) {
+			return fmt.Errorf("Statement %d must have an Action or NotAction that is a string or list of strings", i)
+		}
+	}
+
+	return nil
+}
+
+// validPolicyAction returns true if action is a non empty string, or a non
+// empty list of non empty strings
+func validPolicyAction(action interface{}) bool {
+	switch a := action.(type) {
+	case string:
+		return a != ""
+	case []interface{}:
+		if len(a) == 0 {
+			return false
+		}
+		for _, v := range a {
+			if s, ok := v.(string); !ok || s == "" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
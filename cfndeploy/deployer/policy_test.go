@@ -0,0 +1,34 @@
+package deployer
+
+import (
+	"testing"
+)
+
+func TestValidateStackPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		valid  bool
+	}{
+		{`{"Statement":[{"Effect":"Allow","Action":"Update:*","Principal":"*","Resource":"*"}]}`, true},
+		{`{"Statement":[{"Effect":"Deny","Action":["Update:Replace","Update:Delete"],"Principal":"*","Resource":"LogicalResourceId/Database"}]}`, true},
+		{`{"Statement":[{"Effect":"Deny","NotAction":"Update:Modify","Principal":"*","Resource":"*"}]}`, true},
+		{`{"Statement":[]}`, false},
+		{`{"Statement":[{"Effect":"Maybe","Action":"Update:*"}]}`, false},
+		{`{"Statement":[{"Effect":"Allow"}]}`, false},
+		{`{"Statement":[{"Effect":"Allow","Action":[]}]}`, false},
+		{`{"Statement":[{"Effect":"Allow","Action":[1]}]}`, false},
+		{`not json`, false},
+	}
+
+	for _, tt := range tests {
+		err := validateStackPolicy(tt.policy)
+
+		if tt.valid && err != nil {
+			t.Errorf("Want valid, got %s for %s", err.Error(), tt.policy)
+		}
+
+		if !tt.valid && err == nil {
+			t.Errorf("Want error, got valid for %s", tt.policy)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package deployer
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PulledStack describes a stack that was exported to a template folder
+type PulledStack struct {
+	// Templates holds the files written, relative to the template folder,
+	// starting with the main template
+	Templates []string
+
+	// Params holds the current parameters of the stack, other than those
+	// managed by cfndeploy and those declared with NoEcho
+	Params StackParams
+
+	// NoEchoParams holds the names of parameters declared with NoEcho. Their
+	// values can not be read, so they must be given when deploying.
+	NoEchoParams []string
+
+	Tags StackTags
+}
+
+// Pull writes the original templates of a stack and its nested stacks to a
+// template folder, so that the stack can be deployed with cfndeploy. Nested
+// templates are named by their nested stack path, and the TemplateURL of each
+// nested stack is rewritten to join the TemplateBaseUrl parameter with the
+// name of its template. Templates are written as JSON.
+func (d *deployer) Pull(options *PullOptions) (*PulledStack, error) {
+	stack, err := d.helper.DescribeStack(options.StackName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(options.TemplateFolder, 0755); err != nil {
+		return nil, err
+	}
+
+	p := &puller{
+		d:       d,
+		options: options,
+	}
+
+	root, _, err := p.pull(aws.StringValue(stack.StackId), options.MainTemplate, "", true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pulled := &PulledStack{
+		Templates: p.written,
+		Params:    make(StackParams),
+		Tags:      make(StackTags),
+	}
+
+	noEcho := noEchoParameters(root)
+
+	for _, param := range withoutManaged(stack.Parameters) {
+		key := aws.StringValue(param.ParameterKey)
+
+		if noEcho[key] {
+			pulled.NoEchoParams = append(pulled.NoEchoParams, key)
+			continue
+		}
+
+		pulled.Params[key] = aws.StringValue(param.ParameterValue)
+	}
+
+	sort.Strings(pulled.NoEchoParams)
+
+	for _, tag := range stack.Tags {
+		if key := aws.StringValue(tag.Key); !strings.HasPrefix(key, "aws:") {
+			pulled.Tags[key] = aws.StringValue(tag.Value)
+		}
+	}
+
+	return pulled, nil
+}
+
+// puller writes the templates of a stack and its nested stacks
+type puller struct {
+	d       *deployer
+	options *PullOptions
+	written []string
+}
+
+// pull writes the template of a stack to file, after pulling its nested
+// stacks. It returns the template, and whether the template declares the
+// TemplateBaseUrl parameter, which must then be passed to it by its parent.
+func (p *puller) pull(stackID, file, path string, main bool) (map[string]interface{}, bool, error) {
+	resp, err := p.d.svc.GetTemplate(&cloudformation.GetTemplateInput{
+		StackName:     aws.String(stackID),
+		TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	body, err := parseTemplateBody([]byte(aws.StringValue(resp.TemplateBody)))
+
+	if err != nil {
+		return nil, false, fmt.Errorf("Unable to parse the template of stack %s: %s", stackID, err.Error())
+	}
+
+	doc, ok := body.(map[string]interface{})
+
+	if !ok {
+		return nil, false, fmt.Errorf("The template of stack %s is not an object", stackID)
+	}
+
+	live := make(map[string]string)
+	nested, err := p.d.nestedStacks(stackID)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, r := range nested {
+		live[aws.StringValue(r.LogicalResourceId)] = aws.StringValue(r.PhysicalResourceId)
+	}
+
+	resources, _ := doc["Resources"].(map[string]interface{})
+	hasNested := false
+
+	for _, logicalID := range sortedKeys(resources) {
+		resource, _ := resources[logicalID].(map[string]interface{})
+
+		if resource["Type"] != "AWS::CloudFormation::Stack" {
+			continue
+		}
+
+		nestedPath := logicalID
+
+		if path != "" {
+			nestedPath = path + "." + logicalID
+		}
+
+		physicalID, ok := live[logicalID]
+
+		if !ok {
+			log.Printf("Nested stack %s has not been created, so its TemplateURL is left unchanged", nestedPath)
+			continue
+		}
+
+		nestedFile := nestedPath + ".json"
+		_, usesBaseURL, err := p.pull(physicalID, nestedFile, nestedPath, false)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		properties, ok := resource["Properties"].(map[string]interface{})
+
+		if !ok {
+			properties = make(map[string]interface{})
+			resource["Properties"] = properties
+		}
+
+		properties["TemplateURL"] = map[string]interface{}{
+			"Fn::Join": []interface{}{"", []interface{}{
+				map[string]interface{}{"Ref": "TemplateBaseUrl"},
+				nestedFile,
+			}},
+		}
+
+		if usesBaseURL {
+			params, ok := properties["Parameters"].(map[string]interface{})
+
+			if !ok {
+				params = make(map[string]interface{})
+				properties["Parameters"] = params
+			}
+
+			params["TemplateBaseUrl"] = map[string]interface{}{"Ref": "TemplateBaseUrl"}
+		}
+
+		hasNested = true
+	}
+
+	// the main template is always given the managed parameters, and nested
+	// templates need the base URL to find their own nested templates
+	if main {
+		declareParameter(doc, "Version")
+		declareParameter(doc, "TemplateBaseUrl")
+	} else if hasNested {
+		declareParameter(doc, "TemplateBaseUrl")
+	}
+
+	if err := p.write(file, doc); err != nil {
+		return nil, false, err
+	}
+
+	params, _ := doc["Parameters"].(map[string]interface{})
+	_, usesBaseURL := params["TemplateBaseUrl"]
+
+	return doc, usesBaseURL, nil
+}
+
+// write writes a pulled template to the template folder
+func (p *puller) write(file string, doc map[string]interface{}) error {
+	target := filepath.Join(p.options.TemplateFolder, file)
+
+	if _, err := os.Stat(target); err == nil && !p.options.Overwrite {
+		return fmt.Errorf("Template %s already exists", target)
+	}
+
+	if err := writeJSONTemplate(target, doc); err != nil {
+		return err
+	}
+
+	// nested templates are written first, but the main template is listed
+	// first
+	if len(p.written) > 0 && file == p.options.MainTemplate {
+		p.written = append([]string{file}, p.written...)
+	} else {
+		p.written = append(p.written, file)
+	}
+
+	return nil
+}
+
+// declareParameter adds a string parameter to a template, unless it is
+// already declared
+func declareParameter(doc map[string]interface{}, name string) {
+	params, ok := doc["Parameters"].(map[string]interface{})
+
+	if !ok {
+		params = make(map[string]interface{})
+		doc["Parameters"] = params
+	}
+
+	if _, ok := params[name]; !ok {
+		params[name] = map[string]interface{}{"Type": "String"}
+	}
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
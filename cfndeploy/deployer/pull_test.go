@@ -0,0 +1,134 @@
+package deployer
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const pulledRoot = `
+AWSTemplateFormatVersion: 2010-09-09
+Parameters:
+  Password:
+    Type: String
+    NoEcho: true
+  Env:
+    Type: String
+Resources:
+  Web:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: https://s3.amazonaws.com/other-bucket/web.yaml
+      Parameters:
+        Env: !Ref Env
+`
+
+const pulledWeb = `{
+    "Parameters": {"Env": {"Type": "String"}},
+    "Resources": {
+        "Database": {
+            "Type": "AWS::CloudFormation::Stack",
+            "Properties": {"TemplateURL": "https://s3.amazonaws.com/other-bucket/db.json"}
+        }
+    }
+}`
+
+const pulledDatabase = `{"Resources": {"Table": {"Type": "AWS::DynamoDB::Table"}}}`
+
+func TestPull(t *testing.T) {
+	api := &templateAPI{
+		driftAPI: driftAPI{
+			nested: map[string][]*cloudformation.StackResourceSummary{
+				"root": {{LogicalResourceId: aws.String("Web"), ResourceType: aws.String("AWS::CloudFormation::Stack"), PhysicalResourceId: aws.String("web")}},
+				"web":  {{LogicalResourceId: aws.String("Database"), ResourceType: aws.String("AWS::CloudFormation::Stack"), PhysicalResourceId: aws.String("db")}},
+			},
+		},
+		stack: &cloudformation.Stack{
+			StackName: aws.String("stack"),
+			StackId:   aws.String("root"),
+			Parameters: []*cloudformation.Parameter{
+				{ParameterKey: aws.String("Password"), ParameterValue: aws.String("****")},
+				{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+				{ParameterKey: aws.String("Version"), ParameterValue: aws.String("abc")},
+			},
+			Tags: []*cloudformation.Tag{{Key: aws.String("Team"), Value: aws.String("web")}},
+		},
+		templates: map[string]string{"root": pulledRoot, "web": pulledWeb, "db": pulledDatabase},
+	}
+
+	d := &deployer{svc: api, helper: &cloudFormationHelper{api}}
+
+	folder, err := ioutil.TempDir("", "cfndeploy")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer os.RemoveAll(folder)
+
+	pulled, err := d.Pull(&PullOptions{StackName: "stack", TemplateFolder: folder, MainTemplate: "Stack.json"})
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	if want := []string{"Stack.json", "Web.Database.json", "Web.json"}; !reflect.DeepEqual(pulled.Templates, want) {
+		t.Errorf("Want templates %v, got %v", want, pulled.Templates)
+	}
+
+	if want := (StackParams{"Env": "prod"}); !reflect.DeepEqual(pulled.Params, want) {
+		t.Errorf("Want params %v, got %v", want, pulled.Params)
+	}
+
+	if want := []string{"Password"}; !reflect.DeepEqual(pulled.NoEchoParams, want) {
+		t.Errorf("Want NoEcho params %v, got %v", want, pulled.NoEchoParams)
+	}
+
+	if want := (StackTags{"Team": "web"}); !reflect.DeepEqual(pulled.Tags, want) {
+		t.Errorf("Want tags %v, got %v", want, pulled.Tags)
+	}
+
+	baseURL := map[string]interface{}{"Ref": "TemplateBaseUrl"}
+
+	tests := []struct {
+		template string
+		path     []string
+		want     interface{}
+	}{
+		{"Stack.json", []string{"AWSTemplateFormatVersion"}, "2010-09-09"},
+		{"Stack.json", []string{"Parameters", "Version"}, map[string]interface{}{"Type": "String"}},
+		{"Stack.json", []string{"Parameters", "TemplateBaseUrl"}, map[string]interface{}{"Type": "String"}},
+		{"Stack.json", []string{"Resources", "Web", "Properties", "TemplateURL"}, map[string]interface{}{"Fn::Join": []interface{}{"", []interface{}{baseURL, "Web.json"}}}},
+		{"Stack.json", []string{"Resources", "Web", "Properties", "Parameters"}, map[string]interface{}{"Env": map[string]interface{}{"Ref": "Env"}, "TemplateBaseUrl": baseURL}},
+		{"Web.json", []string{"Parameters", "TemplateBaseUrl"}, map[string]interface{}{"Type": "String"}},
+		{"Web.json", []string{"Resources", "Database", "Properties", "TemplateURL"}, map[string]interface{}{"Fn::Join": []interface{}{"", []interface{}{baseURL, "Web.Database.json"}}}},
+		{"Web.Database.json", []string{"Parameters"}, nil},
+	}
+
+	for _, test := range tests {
+		doc, err := readJSONTemplate(filepath.Join(folder, test.template))
+
+		if err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+
+		var got interface{} = doc
+
+		for _, key := range test.path {
+			m, _ := got.(map[string]interface{})
+			got = m[key]
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Want %s %v to be %v, got %v", test.template, test.path, test.want, got)
+		}
+	}
+
+	if _, err := d.Pull(&PullOptions{StackName: "stack", TemplateFolder: folder, MainTemplate: "Stack.json"}); err == nil {
+		t.Errorf("Want error when templates exist, got nil")
+	}
+}
@@ -0,0 +1,134 @@
+package deployer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateSuffix marks files that are rendered with text/template before they
+// are staged. The suffix is removed from the name of the rendered file.
+const templateSuffix = ".tmpl"
+
+// TemplateVars holds the variables that templates ending in .tmpl are
+// rendered with
+type TemplateVars map[string]interface{}
+
+// Render renders the templates in folder and resolves their includes, then
+// writes all files that would be uploaded when deploying to dir. It returns
+// the names of the files written.
+func Render(folder, dir string, vars TemplateVars) ([]string, error) {
+	b, err := newBuild(folder, "", vars)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer b.Close()
+
+	var files []string
+
+	for _, staged := range b.templates {
+		rel, err := filepath.Rel(b.templateDir, staged)
+
+		if err != nil {
+			return nil, err
+		}
+
+		file := filepath.Join(dir, rel)
+
+		if err := copyFile(staged, file); err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// isTemplateSource returns true if file must be rendered before it is staged
+func isTemplateSource(file string) bool {
+	return strings.HasSuffix(file, templateSuffix)
+}
+
+// renderTemplate renders the template in src with vars, and writes the result
+// to dst. Referring to a variable that is not set is an error.
+func renderTemplate(src, dst string, vars TemplateVars) error {
+	buf, err := ioutil.ReadFile(src)
+
+	if err != nil {
+		return err
+	}
+
+	t, err := template.New(filepath.Base(src)).
+		Option("missingkey=error").
+		Funcs(templateFuncs(vars)).
+		Parse(string(buf))
+
+	if err != nil {
+		return fmt.Errorf("Unable to parse template %s: %s", src, err.Error())
+	}
+
+	var out bytes.Buffer
+
+	if err := t.Execute(&out, map[string]interface{}(vars)); err != nil {
+		return fmt.Errorf("Unable to render template %s: %s", src, err.Error())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(dst, out.Bytes(), 0644)
+}
+
+// templateFuncs returns the helper functions available to templates
+func templateFuncs(vars TemplateVars) template.FuncMap {
+	return template.FuncMap{
+		// var returns the named variable, or def if it is not set
+		"var": func(name string, def interface{}) interface{} {
+			if v, ok := vars[name]; ok {
+				return v
+			}
+			return def
+		},
+
+		// env returns the value of an environment variable
+		"env": os.Getenv,
+
+		// default returns def if value is empty
+		"default": func(def, value interface{}) interface{} {
+			if value == nil || value == "" {
+				return def
+			}
+			return value
+		},
+
+		// required returns an error with message if value is empty
+		"required": func(message string, value interface{}) (interface{}, error) {
+			if value == nil || value == "" {
+				return nil, fmt.Errorf("%s", message)
+			}
+			return value, nil
+		},
+
+		// toJSON encodes value as JSON, for example to render a list
+		"toJSON": func(value interface{}) (string, error) {
+			buf, err := json.Marshal(value)
+			return string(buf), err
+		},
+
+		"join":    strings.Join,
+		"split":   strings.Split,
+		"upper":   strings.ToUpper,
+		"lower":   strings.ToLower,
+		"replace": strings.Replace,
+		"trim":    strings.TrimSpace,
+	}
+}
@@ -0,0 +1,102 @@
+package deployer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfndeploy-test")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	files, err := Render("./test-fixtures/templates/rendered", dir, TemplateVars{"Environment": "PROD"})
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	want := filepath.Join(dir, "Stack.json")
+
+	if len(files) != 1 || files[0] != want {
+		t.Fatalf("Want [%s], got %v", want, files)
+	}
+
+	doc, err := readJSONTemplate(want)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	properties := doc["Resources"].(map[string]interface{})["Queue"].(map[string]interface{})["Properties"].(map[string]interface{})
+
+	if got := properties["QueueName"]; got != "prod-queue" {
+		t.Errorf("Want prod-queue, got %v", got)
+	}
+
+	if got := properties["VisibilityTimeout"].(json.Number).String(); got != "30" {
+		t.Errorf("Want 30, got %s", got)
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfndeploy-test")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		template string
+		vars     TemplateVars
+		want     string
+		err      string
+	}{
+		{`{{ .Name }}`, TemplateVars{"Name": "foo"}, "foo", ""},
+		{`{{ .Name | upper }}`, TemplateVars{"Name": "foo"}, "FOO", ""},
+		{`{{ var "Name" "bar" }}`, TemplateVars{}, "bar", ""},
+		{`{{ .Name | default "bar" }}`, TemplateVars{"Name": ""}, "bar", ""},
+		{`{{ toJSON .Subnets }}`, TemplateVars{"Subnets": []interface{}{"a", "b"}}, `["a","b"]`, ""},
+		{`{{ .Name }}`, TemplateVars{}, "", "map has no entry for key"},
+		{`{{ .Name | required "Name is required" }}`, TemplateVars{"Name": ""}, "", "Name is required"},
+	}
+
+	for i, tt := range tests {
+		src := filepath.Join(dir, "Stack.json.tmpl")
+		dst := filepath.Join(dir, "Stack.json")
+
+		if err := ioutil.WriteFile(src, []byte(tt.template), 0644); err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+
+		err := renderTemplate(src, dst, tt.vars)
+
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%d: Want error containing '%s', got %v", i, tt.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%d: Error: %s", i, err.Error())
+			continue
+		}
+
+		got, _ := ioutil.ReadFile(dst)
+
+		if string(got) != tt.want {
+			t.Errorf("%d: Want %s, got %s", i, tt.want, got)
+		}
+	}
+}
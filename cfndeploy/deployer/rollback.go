@@ -0,0 +1,117 @@
+package deployer
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"log"
+	"strings"
+	"time"
+)
+
+// RollbackFailure is a resource that failed during the most recent rollback
+// of a stack or one of its nested stacks
+type RollbackFailure struct {
+	*cloudformation.StackEvent
+
+	// Path is the logical ID of the resource, prefixed by the logical IDs of
+	// the nested stacks that contain it, separated by dots. This is the form
+	// expected when skipping the resource.
+	Path string
+}
+
+// RollbackFailures returns the resources that failed during the most recent
+// rollback of the named stack, including those in nested stacks
+func (d *deployer) RollbackFailures(stackName string) ([]*RollbackFailure, error) {
+	return d.rollbackFailures(stackName, "")
+}
+
+func (d *deployer) rollbackFailures(stackID, pathPrefix string) ([]*RollbackFailure, error) {
+	evts, err := d.helper.EventsSince(stackID, isRollbackStart)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		failures []*RollbackFailure
+		seen     = make(map[string]bool)
+	)
+
+	// events are ordered from newest to oldest, so only the most recent
+	// status of each resource is considered
+	for _, e := range evts {
+		logicalID := aws.StringValue(e.LogicalResourceId)
+
+		if seen[logicalID] || events.IsStackEvent(e) {
+			continue
+		}
+
+		seen[logicalID] = true
+
+		if !strings.HasSuffix(aws.StringValue(e.ResourceStatus), "_FAILED") {
+			continue
+		}
+
+		path := pathPrefix + logicalID
+
+		if aws.StringValue(e.ResourceType) == "AWS::CloudFormation::Stack" && aws.StringValue(e.PhysicalResourceId) != "" {
+			nested, err := d.rollbackFailures(*e.PhysicalResourceId, path+".")
+
+			if err != nil {
+				return nil, err
+			}
+
+			if len(nested) > 0 {
+				failures = append(failures, nested...)
+				continue
+			}
+		}
+
+		failures = append(failures, &RollbackFailure{StackEvent: e, Path: path})
+	}
+
+	return failures, nil
+}
+
+// ContinueUpdateRollback continues rolling back a stack that is in the
+// UPDATE_ROLLBACK_FAILED state, skipping the given resources, and waits for
+// the rollback to complete
+func (d *deployer) ContinueUpdateRollback(options *ContinueUpdateRollbackOptions) error {
+	stack, err := d.helper.DescribeStack(options.StackName)
+
+	if err != nil {
+		return err
+	}
+
+	if status := aws.StringValue(stack.StackStatus); status != cloudformation.StackStatusUpdateRollbackFailed {
+		return fmt.Errorf("Stack %s is %s. Only stacks that are %s can continue to roll back", options.StackName, status, cloudformation.StackStatusUpdateRollbackFailed)
+	}
+
+	params := &cloudformation.ContinueUpdateRollbackInput{
+		StackName:          stack.StackId,
+		ClientRequestToken: aws.String(clientRequestToken("continue-rollback", time.Now())),
+	}
+
+	if len(options.ResourcesToSkip) > 0 {
+		params.ResourcesToSkip = aws.StringSlice(options.ResourcesToSkip)
+	}
+
+	if options.ServiceRoleARN != "" {
+		params.RoleARN = aws.String(options.ServiceRoleARN)
+	}
+
+	log.Printf("Continuing rollback of stack %s", options.StackName)
+
+	if _, err := d.svc.ContinueUpdateRollback(params); err != nil {
+		return err
+	}
+
+	return d.waitForOperation(aws.StringValue(stack.StackId), aws.StringValue(params.ClientRequestToken), cloudformation.StackStatusUpdateRollbackComplete, nil, operationTimeout)
+}
+
+// isRollbackStart returns true if e marks the start of a rollback of its stack
+func isRollbackStart(e *cloudformation.StackEvent) bool {
+	return events.IsStackEvent(e) && aws.StringValue(e.ResourceStatus) == cloudformation.ResourceStatusUpdateRollbackInProgress
+}
@@ -0,0 +1,87 @@
+package deployer
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"testing"
+)
+
+func TestIsRollbackStart(t *testing.T) {
+	stackID := "arn:aws:cloudformation:ap-southeast-2:123456789012:stack/test/abc"
+
+	tests := []struct {
+		event *cloudformation.StackEvent
+		want  bool
+	}{
+		{&cloudformation.StackEvent{
+			StackId:            aws.String(stackID),
+			PhysicalResourceId: aws.String(stackID),
+			ResourceType:       aws.String("AWS::CloudFormation::Stack"),
+			ResourceStatus:     aws.String("UPDATE_ROLLBACK_IN_PROGRESS"),
+		}, true},
+		{&cloudformation.StackEvent{
+			StackId:            aws.String(stackID),
+			PhysicalResourceId: aws.String("arn:aws:cloudformation:ap-southeast-2:123456789012:stack/nested/def"),
+			ResourceType:       aws.String("AWS::CloudFormation::Stack"),
+			ResourceStatus:     aws.String("UPDATE_ROLLBACK_IN_PROGRESS"),
+		}, false},
+		{&cloudformation.StackEvent{
+			StackId:            aws.String(stackID),
+			PhysicalResourceId: aws.String(stackID),
+			ResourceType:       aws.String("AWS::CloudFormation::Stack"),
+			ResourceStatus:     aws.String("UPDATE_IN_PROGRESS"),
+		}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isRollbackStart(tt.event); got != tt.want {
+			t.Errorf("Want %t, got %t", tt.want, got)
+		}
+	}
+}
+
+func TestRollbackMonitorChecksStackResources(t *testing.T) {
+	stackID := "arn:aws:cloudformation:ap-southeast-2:123456789012:stack/test/abc"
+
+	tests := []struct {
+		status         string
+		complete       bool
+		wantDescribed  bool
+		wantMonitoring bool
+	}{
+		{"CREATE_IN_PROGRESS", true, false, false},
+		{"CREATE_COMPLETE", false, true, false},
+		{"CREATE_COMPLETE", true, true, true},
+	}
+
+	for _, tt := range tests {
+		described := false
+
+		m := &rollbackMonitor{
+			rollback: &RollbackConfiguration{AlarmARNs: []string{"arn:aws:cloudwatch:ap-southeast-2:123456789012:alarm:errors"}},
+			stackID:  stackID,
+			resourcesComplete: func(string) (bool, error) {
+				described = true
+				return tt.complete, nil
+			},
+		}
+
+		m.event(&events.Event{StackEvent: &cloudformation.StackEvent{
+			StackId:            aws.String(stackID),
+			StackName:          aws.String("test"),
+			LogicalResourceId:  aws.String("Queue"),
+			PhysicalResourceId: aws.String("queue"),
+			ResourceType:       aws.String("AWS::SQS::Queue"),
+			ResourceStatus:     aws.String(tt.status),
+		}})
+
+		if described != tt.wantDescribed {
+			t.Errorf("%s: want described %t, got %t", tt.status, tt.wantDescribed, described)
+		}
+
+		if m.monitoring != tt.wantMonitoring {
+			t.Errorf("%s: want monitoring %t, got %t", tt.status, tt.wantMonitoring, m.monitoring)
+		}
+	}
+}
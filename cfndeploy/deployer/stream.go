@@ -0,0 +1,197 @@
+package deployer
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"sort"
+	"time"
+)
+
+// streamedStack is a stack whose events are being streamed. The first poll
+// streams the events of the current operation, which are those with the
+// client request token if one is known. Otherwise they are the events since
+// the most recent start of an operation on the stack.
+type streamedStack struct {
+	stackID string
+
+	// path is the nested stack path of the stack, which is empty for the
+	// root stack
+	path string
+
+	// token is the client request token of the operation, if known
+	token string
+
+	// since is the time the operation started, if known. Older events are
+	// never streamed.
+	since time.Time
+
+	// lastEventID is the ID of the most recent event streamed so far
+	lastEventID string
+
+	// done is true once the stack has reached a terminal state
+	done bool
+}
+
+// eventStream streams the events of a stack and its nested stacks
+type eventStream struct {
+	helper *cloudFormationHelper
+	stacks []*streamedStack
+	seen   map[string]bool
+}
+
+// newEventStream creates an eventStream for the operation on the stack that
+// was started with token, or the most recent operation if token is empty
+func newEventStream(helper *cloudFormationHelper, stackID, token string) *eventStream {
+	return &eventStream{
+		helper: helper,
+		stacks: []*streamedStack{{
+			stackID: stackID,
+			token:   token,
+		}},
+		seen: map[string]bool{stackID: true},
+	}
+}
+
+// poll returns the new events of all stacks that are still being streamed,
+// ordered by time, and starts streaming any nested stacks they reveal
+func (s *eventStream) poll() ([]*events.Event, error) {
+	var all []*events.Event
+
+	// nested stacks found in this poll are appended to s.stacks, and are
+	// polled in the same pass
+	for i := 0; i < len(s.stacks); i++ {
+		stack := s.stacks[i]
+
+		if stack.done {
+			continue
+		}
+
+		evts, err := s.newStackEvents(stack)
+
+		if err != nil {
+			return all, err
+		}
+
+		for _, e := range evts {
+			all = append(all, &events.Event{StackEvent: e, Path: stack.path})
+			s.follow(e, stack)
+		}
+	}
+
+	sort.Stable(byTimestamp(all))
+
+	return all, nil
+}
+
+// follow starts streaming the nested stack that e refers to, if any, or marks
+// stack as done if e shows that it has reached a terminal state
+func (s *eventStream) follow(e *cloudformation.StackEvent, stack *streamedStack) {
+	if events.IsStackEvent(e) {
+		if !inProgressRegexp.MatchString(aws.StringValue(e.ResourceStatus)) {
+			stack.done = true
+		}
+		return
+	}
+
+	nestedID := aws.StringValue(e.PhysicalResourceId)
+
+	if aws.StringValue(e.ResourceType) != "AWS::CloudFormation::Stack" || nestedID == "" || s.seen[nestedID] {
+		return
+	}
+
+	s.seen[nestedID] = true
+
+	path := aws.StringValue(e.LogicalResourceId)
+
+	if stack.path != "" {
+		path = stack.path + "." + path
+	}
+
+	s.stacks = append(s.stacks, &streamedStack{
+		stackID: nestedID,
+		path:    path,
+		since:   aws.TimeValue(e.Timestamp),
+	})
+}
+
+// newStackEvents returns the events of stack that have not been streamed yet,
+// from oldest to newest. Events are paged through until the last event
+// streamed is reached or, on the first poll, until the start of the current
+// operation is reached. If the start of the operation cannot be found yet,
+// nothing is returned, so that events of a previous operation are never
+// streamed.
+func (s *eventStream) newStackEvents(stack *streamedStack) ([]*cloudformation.StackEvent, error) {
+	var (
+		evts  []*cloudformation.StackEvent
+		found bool
+		first = stack.lastEventID == ""
+	)
+
+	params := &cloudformation.DescribeStackEventsInput{
+		StackName: aws.String(stack.stackID),
+	}
+
+	err := s.helper.svc.DescribeStackEventsPages(params, func(page *cloudformation.DescribeStackEventsOutput, lastPage bool) bool {
+		for _, e := range page.StackEvents {
+			if !first && aws.StringValue(e.EventId) == stack.lastEventID {
+				return false
+			}
+
+			if first && !stack.isCurrent(e) {
+				found = true
+				return false
+			}
+
+			evts = append(evts, e)
+
+			if first && stack.token == "" && events.IsOperationStart(e) {
+				found = true
+				return false
+			}
+		}
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// without a token or start time, the operation is only known once the
+	// event that starts it is found
+	if first && !found && stack.token == "" && stack.since.IsZero() {
+		return nil, nil
+	}
+
+	if len(evts) == 0 {
+		return nil, nil
+	}
+
+	stack.lastEventID = aws.StringValue(evts[0].EventId)
+
+	reversed := make([]*cloudformation.StackEvent, len(evts))
+
+	for i, e := range evts {
+		reversed[len(evts)-1-i] = e
+	}
+
+	return reversed, nil
+}
+
+// isCurrent returns false if e is known to belong to an earlier operation
+func (stack *streamedStack) isCurrent(e *cloudformation.StackEvent) bool {
+	if stack.token != "" && aws.StringValue(e.ClientRequestToken) != stack.token {
+		return false
+	}
+
+	return stack.since.IsZero() || !aws.TimeValue(e.Timestamp).Before(stack.since)
+}
+
+// byTimestamp sorts events from oldest to newest
+type byTimestamp []*events.Event
+
+func (a byTimestamp) Len() int      { return len(a) }
+func (a byTimestamp) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byTimestamp) Less(i, j int) bool {
+	return aws.TimeValue(a[i].Timestamp).Before(aws.TimeValue(a[j].Timestamp))
+}
@@ -0,0 +1,156 @@
+package deployer
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"testing"
+	"time"
+)
+
+// stackEventsAPI returns canned stack events, newest first, for each stack.
+// Events are returned two to a page.
+type stackEventsAPI struct {
+	cloudformationiface.CloudFormationAPI
+	events map[string][]*cloudformation.StackEvent
+}
+
+func (api *stackEventsAPI) DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	return &cloudformation.DescribeStackEventsOutput{
+		StackEvents: api.events[aws.StringValue(input.StackName)],
+	}, nil
+}
+
+func (api *stackEventsAPI) DescribeStackEventsPages(input *cloudformation.DescribeStackEventsInput, fn func(*cloudformation.DescribeStackEventsOutput, bool) bool) error {
+	evts := api.events[aws.StringValue(input.StackName)]
+
+	for i := 0; i < len(evts); i += 2 {
+		end := i + 2
+
+		if end > len(evts) {
+			end = len(evts)
+		}
+
+		if !fn(&cloudformation.DescribeStackEventsOutput{StackEvents: evts[i:end]}, end == len(evts)) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func stackEvent(stackID, logicalID, physicalID, resourceType, status string, minute int) *cloudformation.StackEvent {
+	return &cloudformation.StackEvent{
+		EventId:            aws.String(stackID + logicalID + status),
+		StackId:            aws.String(stackID),
+		LogicalResourceId:  aws.String(logicalID),
+		PhysicalResourceId: aws.String(physicalID),
+		ResourceType:       aws.String(resourceType),
+		ResourceStatus:     aws.String(status),
+		Timestamp:          aws.Time(time.Date(2016, 5, 1, 10, minute, 0, 0, time.UTC)),
+	}
+}
+
+// withToken sets the client request token of events
+func withToken(token string, evts ...*cloudformation.StackEvent) []*cloudformation.StackEvent {
+	for _, e := range evts {
+		e.ClientRequestToken = aws.String(token)
+	}
+	return evts
+}
+
+func TestEventStreamFollowsNestedStacks(t *testing.T) {
+	api := &stackEventsAPI{events: make(map[string][]*cloudformation.StackEvent)}
+
+	previous := withToken("previous",
+		stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 0),
+		stackEvent("root", "Web", "web", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 0),
+		stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 0),
+	)
+
+	api.events["root"] = previous
+	s := newEventStream(&cloudFormationHelper{api}, "root", "current")
+
+	if evts, _ := s.poll(); len(evts) != 0 {
+		t.Fatalf("Want no events of the previous operation, got %d", len(evts))
+	}
+
+	api.events["root"] = append(withToken("current",
+		stackEvent("root", "Queue", "queue", "AWS::SQS::Queue", "UPDATE_COMPLETE", 3),
+		stackEvent("root", "Web", "web", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 2),
+		stackEvent("root", "Queue", "queue", "AWS::SQS::Queue", "UPDATE_IN_PROGRESS", 2),
+		stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 1),
+	), previous...)
+
+	api.events["web"] = []*cloudformation.StackEvent{
+		stackEvent("web", "web", "web", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 5),
+		stackEvent("web", "LoadBalancer", "lb", "AWS::ElasticLoadBalancing::LoadBalancer", "UPDATE_COMPLETE", 4),
+		stackEvent("web", "web", "web", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 2),
+		stackEvent("web", "web", "web", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 0),
+	}
+
+	evts, err := s.poll()
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	want := []struct {
+		path      string
+		logicalID string
+		status    string
+	}{
+		{"", "root", "UPDATE_IN_PROGRESS"},
+		{"", "Queue", "UPDATE_IN_PROGRESS"},
+		{"", "Web", "UPDATE_IN_PROGRESS"},
+		{"Web", "web", "UPDATE_IN_PROGRESS"},
+		{"", "Queue", "UPDATE_COMPLETE"},
+		{"Web", "LoadBalancer", "UPDATE_COMPLETE"},
+		{"Web", "web", "UPDATE_COMPLETE"},
+	}
+
+	if len(evts) != len(want) {
+		t.Fatalf("Want %d events, got %d", len(want), len(evts))
+	}
+
+	for i, w := range want {
+		got := evts[i]
+
+		if got.Path != w.path || aws.StringValue(got.LogicalResourceId) != w.logicalID || aws.StringValue(got.ResourceStatus) != w.status {
+			t.Errorf("Want %s %s %s, got %s %s %s", w.path, w.logicalID, w.status, got.Path, aws.StringValue(got.LogicalResourceId), aws.StringValue(got.ResourceStatus))
+		}
+	}
+
+	if !s.stacks[1].done {
+		t.Errorf("Want nested stack to be done")
+	}
+
+	if s.stacks[0].done {
+		t.Errorf("Want root stack to still be streamed")
+	}
+
+	api.events["root"] = append(withToken("current",
+		stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 6),
+	), api.events["root"]...)
+
+	if evts, _ := s.poll(); len(evts) != 1 || !s.stacks[0].done {
+		t.Errorf("Want only the new event, got %d", len(evts))
+	}
+}
+
+func TestEventStreamWithoutToken(t *testing.T) {
+	api := &stackEventsAPI{events: map[string][]*cloudformation.StackEvent{
+		"root": {
+			stackEvent("root", "Queue", "queue", "AWS::SQS::Queue", "UPDATE_IN_PROGRESS", 2),
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 1),
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 0),
+		},
+	}}
+
+	s := newEventStream(&cloudFormationHelper{api}, "root", "")
+	evts, _ := s.poll()
+
+	if len(evts) != 2 || aws.StringValue(evts[0].LogicalResourceId) != "root" {
+		t.Errorf("Want events since the start of the operation, got %d", len(evts))
+	}
+}
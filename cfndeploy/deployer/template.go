@@ -0,0 +1,213 @@
+package deployer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bernos/cfn-deploy/cfndeploy/history"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// parseTemplateBody parses a JSON or YAML template or fragment. Numbers in
+// JSON are kept as they were written. The short form YAML tags of intrinsic
+// functions, such as !Ref and !GetAtt, are converted to their long form.
+func parseTemplateBody(buf []byte) (interface{}, error) {
+	var value interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err == nil {
+		return value, nil
+	}
+
+	var node yaml.Node
+
+	if err := yaml.Unmarshal(buf, &node); err != nil {
+		return nil, err
+	}
+
+	return yamlValue(&node)
+}
+
+// readTemplate parses a JSON or YAML template file. It returns false if file
+// is not a template, because it does not hold a mapping. A file that can not
+// be parsed is only an error if its extension is that of a template, as
+// other files, such as the source of an artifact, may be staged along with
+// the templates.
+func readTemplate(file string) (map[string]interface{}, bool, error) {
+	buf, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, err := parseTemplateBody(buf)
+
+	if err != nil {
+		if isTemplateFile(file) {
+			return nil, false, fmt.Errorf("Unable to parse template %s: %s", file, err.Error())
+		}
+		return nil, false, nil
+	}
+
+	doc, ok := value.(map[string]interface{})
+
+	return doc, ok, nil
+}
+
+// isTemplateFile returns true if file has the extension of a template
+func isTemplateFile(file string) bool {
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(file, templateSuffix))) {
+	case ".json", ".yaml", ".yml", ".template":
+		return true
+	}
+	return false
+}
+
+// yamlValue converts a YAML node to the value it would have in JSON
+func yamlValue(n *yaml.Node) (interface{}, error) {
+	var value interface{}
+
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(n.Content[0])
+
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+
+	case yaml.MappingNode:
+		m := make(map[string]interface{})
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := yamlValue(n.Content[i+1])
+
+			if err != nil {
+				return nil, err
+			}
+
+			m[n.Content[i].Value] = v
+		}
+
+		value = m
+
+	case yaml.SequenceNode:
+		list := []interface{}{}
+
+		for _, child := range n.Content {
+			v, err := yamlValue(child)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, v)
+		}
+
+		value = list
+
+	case yaml.ScalarNode:
+		// cloudformation reads dates, such as AWSTemplateFormatVersion, as
+		// strings
+		if isIntrinsicTag(n.Tag) || n.ShortTag() == "!!timestamp" {
+			value = n.Value
+		} else if err := n.Decode(&value); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("Unsupported YAML node at line %d", n.Line)
+	}
+
+	if !isIntrinsicTag(n.Tag) {
+		return value, nil
+	}
+
+	return intrinsicFunction(n.Tag[1:], value), nil
+}
+
+// isIntrinsicTag returns true if tag is a local tag, such as !Ref, rather than
+// a standard YAML tag
+func isIntrinsicTag(tag string) bool {
+	return strings.HasPrefix(tag, "!") && !strings.HasPrefix(tag, "!!")
+}
+
+// intrinsicFunction returns the long form of the intrinsic function with the
+// given short form name
+func intrinsicFunction(name string, value interface{}) map[string]interface{} {
+	switch name {
+	case "Ref", "Condition":
+		return map[string]interface{}{name: value}
+	case "GetAtt":
+		// the short form of GetAtt may be given as Resource.Attribute
+		if s, ok := value.(string); ok {
+			parts := strings.SplitN(s, ".", 2)
+			list := []interface{}{}
+
+			for _, p := range parts {
+				list = append(list, p)
+			}
+
+			value = list
+		}
+	}
+
+	return map[string]interface{}{"Fn::" + name: value}
+}
+
+// noEchoParameters returns the parameters of a parsed template that are
+// declared with NoEcho
+func noEchoParameters(template interface{}) map[string]bool {
+	noEcho := make(map[string]bool)
+	doc, _ := template.(map[string]interface{})
+	declared, _ := doc["Parameters"].(map[string]interface{})
+
+	for key, value := range declared {
+		declaration, _ := value.(map[string]interface{})
+
+		if fmt.Sprint(declaration["NoEcho"]) == "true" {
+			noEcho[key] = true
+		}
+	}
+
+	return noEcho
+}
+
+// readNoEchoParameters returns the parameters of a template file that are
+// declared with NoEcho
+func readNoEchoParameters(file string) (map[string]bool, error) {
+	buf, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := parseTemplateBody(buf)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template %s: %s", file, err.Error())
+	}
+
+	return noEchoParameters(template), nil
+}
+
+// maskNoEcho returns a copy of params in which the values of NoEcho
+// parameters are masked, as cloudformation masks them when describing a stack
+func maskNoEcho(params StackParams, noEcho map[string]bool) StackParams {
+	masked := make(StackParams)
+
+	for key, value := range params {
+		if noEcho[key] {
+			value = history.MaskedValue
+		}
+		masked[key] = value
+	}
+
+	return masked
+}
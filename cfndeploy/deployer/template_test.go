@@ -0,0 +1,72 @@
+package deployer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseTemplateBody(t *testing.T) {
+	tests := []struct {
+		body string
+		want interface{}
+	}{
+		{`{"A": 1}`, map[string]interface{}{"A": json.Number("1")}},
+		{`A: 1`, map[string]interface{}{"A": 1}},
+		{`A: 2010-09-09`, map[string]interface{}{"A": "2010-09-09"}},
+		{`A: !Ref B`, map[string]interface{}{"A": map[string]interface{}{"Ref": "B"}}},
+		{`A: !GetAtt B.Arn`, map[string]interface{}{"A": map[string]interface{}{"Fn::GetAtt": []interface{}{"B", "Arn"}}}},
+		{`A: !Sub "${B}-c"`, map[string]interface{}{"A": map[string]interface{}{"Fn::Sub": "${B}-c"}}},
+		{
+			`A: !If [IsProd, !Ref B, !Ref "AWS::NoValue"]`,
+			map[string]interface{}{"A": map[string]interface{}{"Fn::If": []interface{}{
+				"IsProd",
+				map[string]interface{}{"Ref": "B"},
+				map[string]interface{}{"Ref": "AWS::NoValue"},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseTemplateBody([]byte(test.body))
+
+		if err != nil {
+			t.Errorf("Error parsing %s: %s", test.body, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Want %v, got %v", test.want, got)
+		}
+	}
+}
+
+func TestMaskNoEcho(t *testing.T) {
+	template, err := parseTemplateBody([]byte(`
+Parameters:
+  Password:
+    Type: String
+    NoEcho: true
+  Token:
+    Type: String
+    NoEcho: "true"
+  Env:
+    Type: String
+    NoEcho: false
+`))
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	params := StackParams{"Password": "secret", "Token": "abc", "Env": "prod"}
+	want := StackParams{"Password": "****", "Token": "****", "Env": "prod"}
+
+	if got := maskNoEcho(params, noEchoParameters(template)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %v, got %v", want, got)
+	}
+
+	if params["Password"] != "secret" {
+		t.Errorf("Want params unchanged, got %v", params)
+	}
+}
@@ -0,0 +1,152 @@
+package deployer
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"sync"
+	"time"
+)
+
+var (
+	// watchInterval is the time between polls of a watcher
+	watchInterval = time.Second * 5
+
+	// operationTimeout is the maximum time to wait for a stack operation
+	// that has no longer timeout of its own, not counting any rollback
+	// monitoring period
+	operationTimeout = time.Minute * 20
+)
+
+// StatusChange is a change of the status of the stack being watched
+type StatusChange struct {
+	Status string
+	Reason string
+	Time   time.Time
+}
+
+// Subscription receives the events and status changes of a watched stack
+// operation. Both channels are closed when the watcher stops.
+type Subscription struct {
+	Events   <-chan *events.Event
+	Statuses <-chan *StatusChange
+}
+
+// subscriber is the sending side of a Subscription
+type subscriber struct {
+	events   chan *events.Event
+	statuses chan *StatusChange
+}
+
+// watcher polls the events of an operation on a stack and its nested stacks,
+// once per tick, and delivers new events and changes of the stack status to
+// its subscribers. The status of the stack is taken from its own events, so
+// a single API call per stack is made on each tick.
+type watcher struct {
+	stream *eventStream
+
+	mu          sync.Mutex
+	subscribers []*subscriber
+
+	status string
+}
+
+// newWatcher creates a watcher for the operation on the stack that was started
+// with token, or the most recent operation if token is empty
+func (c cloudFormationHelper) newWatcher(stackID, token string) *watcher {
+	return &watcher{
+		stream: newEventStream(&c, stackID, token),
+	}
+}
+
+// Subscribe returns a new Subscription. It must be called before Run, and the
+// subscription must be drained until its channels are closed.
+func (w *watcher) Subscribe() *Subscription {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := &subscriber{
+		events:   make(chan *events.Event, 100),
+		statuses: make(chan *StatusChange, 10),
+	}
+
+	w.subscribers = append(w.subscribers, s)
+
+	return &Subscription{Events: s.events, Statuses: s.statuses}
+}
+
+// Run polls the stack until the operation reaches a terminal state, stop is
+// closed or timeout passes, then closes all subscriptions. It returns the
+// final status of the stack.
+func (w *watcher) Run(stop <-chan struct{}, timeout time.Duration) (string, error) {
+	defer w.close()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+
+	for {
+		evts, err := w.stream.poll()
+
+		if err != nil {
+			return w.status, err
+		}
+
+		for _, e := range evts {
+			w.publish(e)
+		}
+
+		if w.status != "" && !inProgressRegexp.MatchString(w.status) {
+			return w.status, nil
+		}
+
+		if time.Since(start) > timeout {
+			return w.status, fmt.Errorf("Stack %s did not finish its operation within %s", w.stream.stacks[0].stackID, timeout)
+		}
+
+		select {
+		case <-stop:
+			return w.status, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish delivers e to all subscribers, along with a status change if e is
+// an event of the watched stack itself
+func (w *watcher) publish(e *events.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var change *StatusChange
+
+	if e.Path == "" && events.IsStackEvent(e.StackEvent) && aws.StringValue(e.ResourceStatus) != w.status {
+		w.status = aws.StringValue(e.ResourceStatus)
+
+		change = &StatusChange{
+			Status: w.status,
+			Reason: aws.StringValue(e.ResourceStatusReason),
+			Time:   aws.TimeValue(e.Timestamp),
+		}
+	}
+
+	for _, s := range w.subscribers {
+		s.events <- e
+
+		if change != nil {
+			s.statuses <- change
+		}
+	}
+}
+
+// close closes the channels of all subscribers
+func (w *watcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, s := range w.subscribers {
+		close(s.events)
+		close(s.statuses)
+	}
+}
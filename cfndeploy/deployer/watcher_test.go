@@ -0,0 +1,59 @@
+package deployer
+
+import (
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"testing"
+	"time"
+)
+
+func TestWatcherRun(t *testing.T) {
+	api := &stackEventsAPI{events: map[string][]*cloudformation.StackEvent{
+		"root": withToken("token",
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_ROLLBACK_COMPLETE", 4),
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_ROLLBACK_IN_PROGRESS", 3),
+			stackEvent("root", "Queue", "queue", "AWS::SQS::Queue", "UPDATE_FAILED", 2),
+			stackEvent("root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 1),
+		),
+	}}
+
+	w := (cloudFormationHelper{api}).newWatcher("root", "token")
+	sub := w.Subscribe()
+
+	status, err := w.Run(nil, time.Minute)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	if status != "UPDATE_ROLLBACK_COMPLETE" {
+		t.Errorf("Want UPDATE_ROLLBACK_COMPLETE, got %s", status)
+	}
+
+	count := 0
+
+	for range sub.Events {
+		count++
+	}
+
+	if count != 4 {
+		t.Errorf("Want 4 events, got %d", count)
+	}
+
+	var statuses []string
+
+	for change := range sub.Statuses {
+		statuses = append(statuses, change.Status)
+	}
+
+	want := []string{"UPDATE_IN_PROGRESS", "UPDATE_ROLLBACK_IN_PROGRESS", "UPDATE_ROLLBACK_COMPLETE"}
+
+	if len(statuses) != len(want) {
+		t.Fatalf("Want %v, got %v", want, statuses)
+	}
+
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Errorf("Want %s, got %s", want[i], statuses[i])
+		}
+	}
+}
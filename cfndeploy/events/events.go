@@ -0,0 +1,271 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/bernos/cfn-deploy/cfndeploy/term"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported output formats
+const (
+	// TextOutput writes one human readable line per event
+	TextOutput = "text"
+
+	// JSONOutput writes a single JSON array holding all events
+	JSONOutput = "json"
+
+	// NDJSONOutput writes one JSON object per line for each event
+	NDJSONOutput = "ndjson"
+)
+
+// Outputs are the names of all supported output formats
+var Outputs = []string{TextOutput, JSONOutput, NDJSONOutput}
+
+// Event is a stack event of a stack or one of its nested stacks
+type Event struct {
+	*cloudformation.StackEvent
+
+	// Path is the logical ID of the nested stack that the event belongs to,
+	// prefixed by the logical IDs of its parent stacks and separated by dots.
+	// It is empty for events of the root stack.
+	Path string
+}
+
+// Depth returns the nesting depth of the stack that the event belongs to
+func (e *Event) Depth() int {
+	if e.Path == "" {
+		return 0
+	}
+	return strings.Count(e.Path, ".") + 1
+}
+
+// IsStackEvent returns true if e is an event for the stack itself, rather
+// than one of its resources
+func IsStackEvent(e *cloudformation.StackEvent) bool {
+	return aws.StringValue(e.ResourceType) == "AWS::CloudFormation::Stack" &&
+		aws.StringValue(e.PhysicalResourceId) == aws.StringValue(e.StackId)
+}
+
+// IsOperationStart returns true if e marks the start of a create, update,
+// delete or import of its stack
+func IsOperationStart(e *cloudformation.StackEvent) bool {
+	if !IsStackEvent(e) {
+		return false
+	}
+
+	switch aws.StringValue(e.ResourceStatus) {
+	case cloudformation.ResourceStatusCreateInProgress,
+		cloudformation.ResourceStatusUpdateInProgress,
+		cloudformation.ResourceStatusDeleteInProgress,
+		cloudformation.ResourceStatusImportInProgress:
+		return true
+	}
+
+	return false
+}
+
+// Formatter writes stack events. It is safe to call Write from multiple
+// goroutines. Close must be called once all events have been written.
+type Formatter interface {
+	Write(e *Event) error
+	Close() error
+}
+
+// New creates a Formatter that writes events to w in the named output format.
+// Stack statuses are coloured in text output if colour is true.
+func New(output string, w io.Writer, colour bool) (Formatter, error) {
+	switch output {
+	case TextOutput, "":
+		return &textFormatter{w: w, colour: colour}, nil
+	case JSONOutput:
+		return &jsonFormatter{w: w}, nil
+	case NDJSONOutput:
+		return &ndjsonFormatter{w: w}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown output '%s'. Expected one of %s", output, strings.Join(Outputs, ", "))
+}
+
+// textFormatter writes one line per event
+type textFormatter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	colour bool
+}
+
+func (f *textFormatter) Write(e *Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, err := io.WriteString(f.w, formatText(e, f.colour)+"\n")
+	return err
+}
+
+func (f *textFormatter) Close() error {
+	return nil
+}
+
+// formatText formats e as a single line holding its timestamp, logical ID,
+// resource type, status and status reason. Events of nested stacks are
+// indented by their depth.
+func formatText(e *Event, colour bool) string {
+	status := aws.StringValue(e.ResourceStatus)
+	padded := fmt.Sprintf("%-44s", status)
+
+	if colour {
+		padded = term.Colourize(statusColour(status), status) + padded[len(status):]
+	}
+
+	logicalID := strings.Repeat("  ", e.Depth()) + aws.StringValue(e.LogicalResourceId)
+
+	line := fmt.Sprintf("%s  %-40s %-40s %s",
+		aws.TimeValue(e.Timestamp).UTC().Format(time.RFC3339),
+		logicalID,
+		aws.StringValue(e.ResourceType),
+		padded)
+
+	if reason := aws.StringValue(e.ResourceStatusReason); reason != "" {
+		line += " " + reason
+	}
+
+	return strings.TrimRight(line, " ")
+}
+
+// statusColour returns the colour of a resource or stack status
+func statusColour(status string) term.Colour {
+	switch {
+	case strings.HasSuffix(status, "_FAILED"), strings.Contains(status, "ROLLBACK"):
+		return term.Red
+	case strings.HasSuffix(status, "_COMPLETE"):
+		return term.Green
+	case strings.HasSuffix(status, "_IN_PROGRESS"):
+		return term.Yellow
+	}
+	return term.Grey
+}
+
+// record is the JSON representation of an event
+type record struct {
+	Timestamp            time.Time `json:"timestamp"`
+	EventID              string    `json:"eventId"`
+	StackName            string    `json:"stackName"`
+	StackID              string    `json:"stackId"`
+	Path                 string    `json:"path,omitempty"`
+	LogicalResourceID    string    `json:"logicalResourceId"`
+	PhysicalResourceID   string    `json:"physicalResourceId,omitempty"`
+	ResourceType         string    `json:"resourceType"`
+	ResourceStatus       string    `json:"resourceStatus"`
+	ResourceStatusReason string    `json:"resourceStatusReason,omitempty"`
+}
+
+// newRecord builds the JSON representation of e
+func newRecord(e *Event) *record {
+	return &record{
+		Timestamp:            aws.TimeValue(e.Timestamp).UTC(),
+		EventID:              aws.StringValue(e.EventId),
+		StackName:            aws.StringValue(e.StackName),
+		StackID:              aws.StringValue(e.StackId),
+		Path:                 e.Path,
+		LogicalResourceID:    aws.StringValue(e.LogicalResourceId),
+		PhysicalResourceID:   aws.StringValue(e.PhysicalResourceId),
+		ResourceType:         aws.StringValue(e.ResourceType),
+		ResourceStatus:       aws.StringValue(e.ResourceStatus),
+		ResourceStatusReason: aws.StringValue(e.ResourceStatusReason),
+	}
+}
+
+// ndjsonFormatter writes one JSON object per line
+type ndjsonFormatter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (f *ndjsonFormatter) Write(e *Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return json.NewEncoder(f.w).Encode(newRecord(e))
+}
+
+func (f *ndjsonFormatter) Close() error {
+	return nil
+}
+
+// jsonFormatter writes a JSON array of events. The array is written as events
+// arrive, and is terminated when the formatter is closed.
+type jsonFormatter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	count int
+}
+
+func (f *jsonFormatter) Write(e *Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	buf, err := json.Marshal(newRecord(e))
+
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n  "
+
+	if f.count == 0 {
+		separator = "[\n  "
+	}
+
+	f.count++
+
+	_, err = io.WriteString(f.w, separator+string(buf))
+	return err
+}
+
+func (f *jsonFormatter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := "\n]\n"
+
+	if f.count == 0 {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(f.w, end)
+	return err
+}
+
+// Multi returns a Formatter that writes each event to all of the given
+// formatters
+func Multi(formatters ...Formatter) Formatter {
+	return multiFormatter(formatters)
+}
+
+type multiFormatter []Formatter
+
+func (m multiFormatter) Write(e *Event) error {
+	for _, f := range m {
+		if err := f.Write(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiFormatter) Close() error {
+	var err error
+
+	for _, f := range m {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
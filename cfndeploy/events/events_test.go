@@ -0,0 +1,139 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEvent(path, logicalID, status, reason string) *Event {
+	return &Event{
+		StackEvent: &cloudformation.StackEvent{
+			EventId:              aws.String(logicalID + "-" + status),
+			StackName:            aws.String("stack"),
+			StackId:              aws.String("arn:aws:cloudformation:ap-southeast-2:123456789012:stack/stack/1"),
+			LogicalResourceId:    aws.String(logicalID),
+			ResourceType:         aws.String("AWS::SQS::Queue"),
+			ResourceStatus:       aws.String(status),
+			ResourceStatusReason: aws.String(reason),
+			Timestamp:            aws.Time(time.Date(2016, 5, 1, 10, 30, 0, 0, time.UTC)),
+		},
+		Path: path,
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	tests := []struct {
+		event *Event
+		want  string
+	}{
+		{
+			testEvent("", "Queue", "CREATE_COMPLETE", ""),
+			"2016-05-01T10:30:00Z  Queue                                    AWS::SQS::Queue                          CREATE_COMPLETE",
+		},
+		{
+			testEvent("Web.Api", "Queue", "CREATE_FAILED", "Access denied"),
+			"2016-05-01T10:30:00Z      Queue                                AWS::SQS::Queue                          CREATE_FAILED                                Access denied",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := formatText(tt.event, false); got != tt.want {
+			t.Errorf("Want %s, got %s", tt.want, got)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		events int
+	}{
+		{JSONOutput, 0},
+		{JSONOutput, 2},
+		{NDJSONOutput, 2},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+
+		f, err := New(tt.output, &buf, false)
+
+		if err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+
+		for i := 0; i < tt.events; i++ {
+			f.Write(testEvent("Web", "Queue", "CREATE_COMPLETE", ""))
+		}
+
+		f.Close()
+
+		var records []*record
+
+		if tt.output == JSONOutput {
+			if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+				t.Fatalf("Error: %s", err.Error())
+			}
+		} else {
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				r := &record{}
+
+				if err := json.Unmarshal([]byte(line), r); err != nil {
+					t.Fatalf("Error: %s", err.Error())
+				}
+
+				records = append(records, r)
+			}
+		}
+
+		if len(records) != tt.events {
+			t.Fatalf("Want %d records, got %d", tt.events, len(records))
+		}
+
+		for _, r := range records {
+			if r.Path != "Web" || r.LogicalResourceID != "Queue" || r.ResourceStatus != "CREATE_COMPLETE" {
+				t.Errorf("Want Web Queue CREATE_COMPLETE, got %s %s %s", r.Path, r.LogicalResourceID, r.ResourceStatus)
+			}
+		}
+	}
+}
+
+func TestNewUnknownOutput(t *testing.T) {
+	if _, err := New("xml", &bytes.Buffer{}, false); err == nil {
+		t.Errorf("Want error for unknown output")
+	}
+}
+
+func TestIsOperationStart(t *testing.T) {
+	stackID := "arn:aws:cloudformation:ap-southeast-2:123456789012:stack/stack/1"
+
+	tests := []struct {
+		resourceType string
+		physicalID   string
+		status       string
+		want         bool
+	}{
+		{"AWS::CloudFormation::Stack", stackID, "UPDATE_IN_PROGRESS", true},
+		{"AWS::CloudFormation::Stack", stackID, "UPDATE_COMPLETE", false},
+		{"AWS::CloudFormation::Stack", "arn:aws:cloudformation:ap-southeast-2:123456789012:stack/nested/2", "UPDATE_IN_PROGRESS", false},
+		{"AWS::SQS::Queue", "queue", "CREATE_IN_PROGRESS", false},
+	}
+
+	for _, tt := range tests {
+		e := &cloudformation.StackEvent{
+			StackId:            aws.String(stackID),
+			PhysicalResourceId: aws.String(tt.physicalID),
+			ResourceType:       aws.String(tt.resourceType),
+			ResourceStatus:     aws.String(tt.status),
+		}
+
+		if got := IsOperationStart(e); got != tt.want {
+			t.Errorf("Want %t, got %t for %s %s", tt.want, got, tt.resourceType, tt.status)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/bernos/cfn-deploy/cfndeploy/uploader"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaskedValue replaces the values of NoEcho parameters
+	MaskedValue = "****"
+
+	// StatusNotStarted is the status of a deployment that failed before its
+	// stack operation was started, for example because it was not approved
+	StatusNotStarted = "NOT_STARTED"
+
+	// StatusNoChanges is the status of a deployment that did not change the
+	// stack
+	StatusNoChanges = "NO_CHANGES"
+
+	// appendAttempts is the number of times an entry is appended to the
+	// index when other deployments append to it at the same time
+	appendAttempts = 5
+)
+
+// Caller is the AWS identity that performed a deployment
+type Caller struct {
+	Account string
+	ARN     string
+	UserID  string
+}
+
+// Entry records a single deployment of a stack
+type Entry struct {
+	StackName string
+	Version   string
+
+	// Templates maps each uploaded template, relative to the main template,
+	// to its SHA1 checksum
+	Templates map[string]string
+
+	// Parameters holds the parameters sent to cloudformation, with the
+	// values of NoEcho parameters masked
+	Parameters map[string]string
+
+	Tags             map[string]string
+	Caller           *Caller `json:",omitempty"`
+	CfndeployVersion string
+	GitCommit        string `json:",omitempty"`
+	Start            time.Time
+	End              time.Time
+
+	// Status is the final status of the stack, or StatusNotStarted
+	Status string
+
+	// Error holds the error the deployment failed with, if any
+	Error string `json:",omitempty"`
+}
+
+// Duration returns the time the deployment took
+func (e *Entry) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// Store is an interface that records and lists deployments of a stack
+type Store interface {
+	Record(bucket, bucketFolder string, entry *Entry) error
+	List(bucket, bucketFolder, stackName string) ([]*Entry, error)
+}
+
+// ManifestKey returns the key of the manifest of a stack version, which is
+// stored alongside its templates
+func ManifestKey(stackName, bucketFolder, version string) string {
+	return path.Join(bucketFolder, stackName, version, "manifest.json")
+}
+
+// IndexKey returns the key of the history index of a stack
+func IndexKey(stackName, bucketFolder string) string {
+	return path.Join(bucketFolder, stackName, "history.json")
+}
+
+// Find returns the entry given by ref, which is either the number of an entry
+// as listed, counting from 1 for the oldest, or a version. The most recent
+// deployment of a version is returned.
+func Find(entries []*Entry, ref string) (*Entry, error) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(entries) {
+			return nil, fmt.Errorf("No history entry %d", n)
+		}
+		return entries[n-1], nil
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if strings.HasPrefix(entries[i].Version, ref) {
+			return entries[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("No history entry for version %s", ref)
+}
+
+// store implements the Store interface
+type store struct {
+	s3 s3iface.S3API
+}
+
+// New creates a new Store instance
+func New(s s3iface.S3API) Store {
+	return &store{
+		s3: s,
+	}
+}
+
+// Record writes the manifest of entry alongside the templates of its version,
+// and appends entry to the history index of its stack
+func (s *store) Record(bucket, bucketFolder string, entry *Entry) error {
+	if err := s.put(bucket, ManifestKey(entry.StackName, bucketFolder, entry.Version), entry, nil); err != nil {
+		return err
+	}
+
+	key := IndexKey(entry.StackName, bucketFolder)
+
+	for attempt := 0; ; attempt++ {
+		entries, etag, err := s.get(bucket, key)
+
+		if err != nil {
+			return err
+		}
+
+		// only replace the index if nobody else has replaced it since it was
+		// read
+		condition := map[string]string{"If-Match": etag}
+
+		if etag == "" {
+			condition = map[string]string{"If-None-Match": "*"}
+		}
+
+		err = s.put(bucket, key, append(entries, entry), condition)
+
+		if err == nil || !uploader.IsConditionFailed(err) || attempt+1 == appendAttempts {
+			return err
+		}
+	}
+}
+
+// List returns all recorded deployments of a stack, oldest first
+func (s *store) List(bucket, bucketFolder, stackName string) ([]*Entry, error) {
+	entries, _, err := s.get(bucket, IndexKey(stackName, bucketFolder))
+	return entries, err
+}
+
+// put writes value as JSON to key, with the given conditional request headers
+func (s *store) put(bucket, key string, value interface{}, headers map[string]string) error {
+	body, err := json.MarshalIndent(value, "", "    ")
+
+	if err != nil {
+		return err
+	}
+
+	params := &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	}
+
+	_, err = s.s3.PutObjectWithContext(aws.BackgroundContext(), params, request.WithSetRequestHeaders(headers))
+
+	return err
+}
+
+// get reads the history index at key, and returns it with its ETag. An index
+// that does not exist yet has no entries, and an empty ETag.
+func (s *store) get(bucket, key string) ([]*Entry, string, error) {
+	resp, err := s.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var entries []*Entry
+
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return nil, "", fmt.Errorf("Unable to read history %s: %s", key, err.Error())
+	}
+
+	return entries, aws.StringValue(resp.ETag), nil
+}
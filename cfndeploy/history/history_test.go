@@ -0,0 +1,141 @@
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// objectStore keeps objects in memory, and honours conditional writes. The
+// index is replaced by another deployment the first time it is written, so
+// that the first conditional write fails.
+type objectStore struct {
+	s3iface.S3API
+	objects  map[string][]byte
+	versions map[string]int
+	raced    bool
+}
+
+func (s *objectStore) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+	body, ok := s.objects[key]
+
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(bytes.NewReader(body)),
+		ETag: aws.String(fmt.Sprint(s.versions[key])),
+	}, nil
+}
+
+func (s *objectStore) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+	r := &request.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+	r.ApplyOptions(opts...)
+
+	if key == IndexKey("stack", "") && !s.raced {
+		s.raced = true
+		s.objects[key] = []byte("[]")
+		s.versions[key]++
+	}
+
+	_, exists := s.objects[key]
+
+	if r.HTTPRequest.Header.Get("If-None-Match") == "*" && exists {
+		return nil, awserr.New("PreconditionFailed", "exists", nil)
+	}
+
+	if etag := r.HTTPRequest.Header.Get("If-Match"); etag != "" && etag != fmt.Sprint(s.versions[key]) {
+		return nil, awserr.New("PreconditionFailed", "changed", nil)
+	}
+
+	body, _ := ioutil.ReadAll(input.Body)
+	s.objects[key] = body
+	s.versions[key]++
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestKeys(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{ManifestKey("stack", "foo", "abc"), "foo/stack/abc/manifest.json"},
+		{ManifestKey("stack", "", "abc"), "stack/abc/manifest.json"},
+		{IndexKey("stack", "foo"), "foo/stack/history.json"},
+		{IndexKey("stack", ""), "stack/history.json"},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("Want %s, got %s", tt.want, tt.got)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	s3 := &objectStore{objects: make(map[string][]byte), versions: make(map[string]int)}
+	h := New(s3)
+
+	for _, version := range []string{"aaa", "bbb", "aaa"} {
+		if err := h.Record("bucket", "", &Entry{StackName: "stack", Version: version}); err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+	}
+
+	if _, ok := s3.objects[ManifestKey("stack", "", "bbb")]; !ok {
+		t.Errorf("Want manifest of version bbb, got none")
+	}
+
+	entries, err := h.List("bucket", "", "stack")
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("Want 3 entries, got %d", len(entries))
+	}
+
+	tests := []struct {
+		ref     string
+		version string
+	}{
+		{"1", "aaa"},
+		{"2", "bbb"},
+		{"bb", "bbb"},
+		{"aaa", "aaa"},
+	}
+
+	for _, tt := range tests {
+		e, err := Find(entries, tt.ref)
+
+		if err != nil {
+			t.Errorf("Error finding %s: %s", tt.ref, err.Error())
+			continue
+		}
+
+		if e.Version != tt.version {
+			t.Errorf("Want version %s for %s, got %s", tt.version, tt.ref, e.Version)
+		}
+	}
+
+	if e, _ := Find(entries, "aaa"); e != entries[2] {
+		t.Errorf("Want most recent deployment of version aaa")
+	}
+
+	for _, ref := range []string{"0", "4", "ccc"} {
+		if _, err := Find(entries, ref); err == nil {
+			t.Errorf("Want error finding %s, got nil", ref)
+		}
+	}
+}
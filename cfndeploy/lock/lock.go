@@ -0,0 +1,284 @@
+package lock
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/bernos/cfn-deploy/cfndeploy/uploader"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"time"
+)
+
+var (
+	// ErrNotLocked means that there is no lock object
+	ErrNotLocked = errors.New("Not locked")
+
+	// pollInterval is the time to wait between attempts to acquire a lock
+	pollInterval = time.Second * 10
+)
+
+// Lock is the content of a lock object
+type Lock struct {
+	ID       string
+	Owner    string
+	Host     string
+	PID      int
+	Acquired time.Time
+	Expires  time.Time
+}
+
+// Expired returns true if the lock has expired at time t
+func (l *Lock) Expired(t time.Time) bool {
+	return t.After(l.Expires)
+}
+
+// String describes the holder of the lock
+func (l *Lock) String() string {
+	return fmt.Sprintf("%s on %s (pid %d), acquired %s, expires %s", l.Owner, l.Host, l.PID,
+		l.Acquired.Format(time.RFC3339), l.Expires.Format(time.RFC3339))
+}
+
+// Locker is an interface that can acquire and release locks stored as
+// objects in S3
+type Locker interface {
+	Acquire(bucket, key, owner string, ttl, timeout time.Duration) (*Lock, error)
+	Release(bucket, key string, lock *Lock) error
+	Current(bucket, key string) (*Lock, error)
+	ForceUnlock(bucket, key string) error
+}
+
+// Key returns the key of the lock object for the given stack
+func Key(stackName, bucketFolder string) string {
+	return path.Join(bucketFolder, stackName, ".lock")
+}
+
+// locker implements the Locker interface
+type locker struct {
+	s3 s3iface.S3API
+}
+
+// New creates a new Locker instance
+func New(s s3iface.S3API) Locker {
+	return &locker{
+		s3: s,
+	}
+}
+
+// Acquire writes a lock object at key, if there is not already an unexpired
+// lock there. If the lock is held by someone else, Acquire waits up to
+// timeout for it to be released or to expire.
+func (l *locker) Acquire(bucket, key, owner string, ttl, timeout time.Duration) (*Lock, error) {
+	start := time.Now()
+
+	for {
+		lock, err := newLock(owner, ttl)
+
+		if err != nil {
+			return nil, err
+		}
+
+		acquired, err := l.tryAcquire(bucket, key, lock)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if acquired {
+			return lock, nil
+		}
+
+		current, err := l.Current(bucket, key)
+
+		if err == ErrNotLocked {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if time.Since(start) >= timeout {
+			return nil, fmt.Errorf("Stack is locked by %s", current)
+		}
+
+		log.Printf("Waiting for lock held by %s", current)
+		time.Sleep(pollInterval)
+	}
+}
+
+// tryAcquire writes lock at key if there is no lock object, or if the
+// existing lock has expired. It returns false if the key is locked by
+// someone else.
+func (l *locker) tryAcquire(bucket, key string, lock *Lock) (bool, error) {
+	err := l.put(bucket, key, lock, "If-None-Match", "*")
+
+	if err == nil {
+		return true, nil
+	}
+
+	if !uploader.IsConditionFailed(err) {
+		return false, err
+	}
+
+	current, etag, err := l.get(bucket, key)
+
+	if err == ErrNotLocked {
+		return false, nil
+	}
+
+	if err != nil || !current.Expired(time.Now()) {
+		return false, err
+	}
+
+	log.Printf("Taking over expired lock held by %s", current)
+
+	// only replace the expired lock if nobody else has replaced it since it
+	// was read
+	if err := l.put(bucket, key, lock, "If-Match", etag); err != nil {
+		if uploader.IsConditionFailed(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Release deletes the lock object at key, if it still holds lock
+func (l *locker) Release(bucket, key string, lock *Lock) error {
+	current, etag, err := l.get(bucket, key)
+
+	if err == ErrNotLocked {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if current.ID != lock.ID {
+		return fmt.Errorf("Lock is now held by %s, not releasing it", current)
+	}
+
+	// only delete the lock if nobody else has taken it over since it was
+	// read
+	err = l.delete(bucket, key, request.WithSetRequestHeaders(map[string]string{
+		"If-Match": etag,
+	}))
+
+	if uploader.IsConditionFailed(err) {
+		return fmt.Errorf("Lock was taken over by someone else while releasing it")
+	}
+
+	return err
+}
+
+// Current returns the lock stored at key, or ErrNotLocked if there is none
+func (l *locker) Current(bucket, key string) (*Lock, error) {
+	lock, _, err := l.get(bucket, key)
+	return lock, err
+}
+
+// ForceUnlock deletes the lock object at key, regardless of who holds it
+func (l *locker) ForceUnlock(bucket, key string) error {
+	return l.delete(bucket, key)
+}
+
+// delete deletes the lock object at key, with the given request options
+func (l *locker) delete(bucket, key string, opts ...request.Option) error {
+	_, err := l.s3.DeleteObjectWithContext(aws.BackgroundContext(), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, opts...)
+
+	return err
+}
+
+// put writes lock to key, with the given conditional request header
+func (l *locker) put(bucket, key string, lock *Lock, header, value string) error {
+	body, err := json.Marshal(lock)
+
+	if err != nil {
+		return err
+	}
+
+	params := &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	}
+
+	_, err = l.s3.PutObjectWithContext(aws.BackgroundContext(), params, request.WithSetRequestHeaders(map[string]string{
+		header: value,
+	}))
+
+	return err
+}
+
+// get reads the lock stored at key, and returns it with its ETag
+func (l *locker) get(bucket, key string) (*Lock, string, error) {
+	resp, err := l.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, "", ErrNotLocked
+		}
+		return nil, "", err
+	}
+
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	lock := &Lock{}
+
+	if err := json.Unmarshal(buf, lock); err != nil {
+		return nil, "", fmt.Errorf("Unable to read lock %s: %s", key, err.Error())
+	}
+
+	return lock, aws.StringValue(resp.ETag), nil
+}
+
+// newLock builds a lock for the current process
+func newLock(owner string, ttl time.Duration) (*Lock, error) {
+	id := make([]byte, 16)
+
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	host, err := os.Hostname()
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	return &Lock{
+		ID:       fmt.Sprintf("%x", id),
+		Owner:    owner,
+		Host:     host,
+		PID:      os.Getpid(),
+		Acquired: now,
+		Expires:  now.Add(ttl),
+	}, nil
+}
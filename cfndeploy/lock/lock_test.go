@@ -0,0 +1,277 @@
+package lock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		bucketFolder string
+		stackName    string
+		want         string
+	}{
+		{"foo", "stack", "foo/stack/.lock"},
+		{"", "stack", "stack/.lock"},
+	}
+
+	for _, tt := range tests {
+		got := Key(tt.stackName, tt.bucketFolder)
+
+		if got != tt.want {
+			t.Errorf("Want %s, got %s", tt.want, got)
+		}
+	}
+}
+
+func TestNewLock(t *testing.T) {
+	l, err := newLock("someone", time.Hour)
+
+	if err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	if l.Owner != "someone" || l.ID == "" || l.Host == "" || l.PID == 0 {
+		t.Errorf("Incomplete lock %#v", l)
+	}
+
+	if l.Expired(time.Now()) {
+		t.Errorf("Want unexpired lock, got expired")
+	}
+
+	if !l.Expired(time.Now().Add(time.Hour * 2)) {
+		t.Errorf("Want expired lock, got unexpired")
+	}
+}
+
+// lockStore keeps objects in memory, and honours the conditional headers of
+// writes and deletes. If race is set, it is called once before the next
+// request that is conditional on If-Match, to let someone else change the
+// lock after it was read.
+type lockStore struct {
+	s3iface.S3API
+	objects  map[string][]byte
+	versions map[string]int
+	race     func(s *lockStore)
+}
+
+func newLockStore(locks map[string]*Lock) *lockStore {
+	s := &lockStore{objects: make(map[string][]byte), versions: make(map[string]int)}
+
+	for key, lock := range locks {
+		s.store(key, lock)
+	}
+
+	return s
+}
+
+func (s *lockStore) store(key string, lock *Lock) {
+	body, _ := json.Marshal(lock)
+	s.objects[key] = body
+	s.versions[key]++
+}
+
+func (s *lockStore) lock(key string) *Lock {
+	body, ok := s.objects[key]
+
+	if !ok {
+		return nil
+	}
+
+	lock := &Lock{}
+	json.Unmarshal(body, lock)
+	return lock
+}
+
+// checkConditions checks the conditional headers of a request on key
+func (s *lockStore) checkConditions(key string, opts []request.Option) error {
+	r := &request.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+	r.ApplyOptions(opts...)
+
+	if race := s.race; race != nil && r.HTTPRequest.Header.Get("If-Match") != "" {
+		s.race = nil
+		race(s)
+	}
+
+	_, exists := s.objects[key]
+
+	if r.HTTPRequest.Header.Get("If-None-Match") == "*" && exists {
+		return awserr.New("PreconditionFailed", "exists", nil)
+	}
+
+	if etag := r.HTTPRequest.Header.Get("If-Match"); etag != "" && (!exists || etag != fmt.Sprint(s.versions[key])) {
+		return awserr.New("PreconditionFailed", "changed", nil)
+	}
+
+	return nil
+}
+
+func (s *lockStore) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+	body, ok := s.objects[key]
+
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(bytes.NewReader(body)),
+		ETag: aws.String(fmt.Sprint(s.versions[key])),
+	}, nil
+}
+
+func (s *lockStore) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+
+	if err := s.checkConditions(key, opts); err != nil {
+		return nil, err
+	}
+
+	body, _ := ioutil.ReadAll(input.Body)
+	s.objects[key] = body
+	s.versions[key]++
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (s *lockStore) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+
+	if err := s.checkConditions(key, opts); err != nil {
+		return nil, err
+	}
+
+	delete(s.objects, key)
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func testLock(id string, expires time.Time) *Lock {
+	return &Lock{ID: id, Owner: id, Host: "host", PID: 1, Expires: expires}
+}
+
+func TestTryAcquire(t *testing.T) {
+	now := time.Now()
+	other := testLock("other", now.Add(time.Hour))
+	expired := testLock("expired", now.Add(-time.Minute))
+
+	tests := []struct {
+		name    string
+		current *Lock
+		race    *Lock
+		want    bool
+		wantID  string
+	}{
+		{"unlocked", nil, nil, true, "mine"},
+		{"held", other, nil, false, "other"},
+		{"expired", expired, nil, true, "mine"},
+		{"expired, taken over by someone else first", expired, other, false, "other"},
+	}
+
+	for _, tt := range tests {
+		locks := make(map[string]*Lock)
+
+		if tt.current != nil {
+			locks["stack/.lock"] = tt.current
+		}
+
+		s := newLockStore(locks)
+
+		if tt.race != nil {
+			race := tt.race
+			s.race = func(s *lockStore) { s.store("stack/.lock", race) }
+		}
+
+		l := &locker{s3: s}
+		got, err := l.tryAcquire("bucket", "stack/.lock", testLock("mine", now.Add(time.Hour)))
+
+		if err != nil {
+			t.Fatalf("%s: Error: %s", tt.name, err.Error())
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: want acquired %t, got %t", tt.name, tt.want, got)
+		}
+
+		if id := s.lock("stack/.lock").ID; id != tt.wantID {
+			t.Errorf("%s: want lock held by %s, got %s", tt.name, tt.wantID, id)
+		}
+	}
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	defer func(interval time.Duration) { pollInterval = interval }(pollInterval)
+	pollInterval = time.Millisecond
+
+	s := newLockStore(map[string]*Lock{"stack/.lock": testLock("other", time.Now().Add(time.Hour))})
+	l := &locker{s3: s}
+
+	if _, err := l.Acquire("bucket", "stack/.lock", "me", time.Hour, time.Millisecond*10); err == nil || !strings.Contains(err.Error(), "Stack is locked by other") {
+		t.Errorf("Want the lock to time out, got %v", err)
+	}
+
+	if id := s.lock("stack/.lock").ID; id != "other" {
+		t.Errorf("Want lock held by other, got %s", id)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	mine := testLock("mine", time.Now().Add(time.Hour))
+	other := testLock("other", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		current *Lock
+		race    *Lock
+		wantErr bool
+		wantID  string
+	}{
+		{"held", mine, nil, false, ""},
+		{"unlocked", nil, nil, false, ""},
+		{"held by someone else", other, nil, true, "other"},
+		{"taken over while releasing", mine, other, true, "other"},
+	}
+
+	for _, tt := range tests {
+		locks := make(map[string]*Lock)
+
+		if tt.current != nil {
+			locks["stack/.lock"] = tt.current
+		}
+
+		s := newLockStore(locks)
+
+		if tt.race != nil {
+			race := tt.race
+			s.race = func(s *lockStore) { s.store("stack/.lock", race) }
+		}
+
+		l := &locker{s3: s}
+		err := l.Release("bucket", "stack/.lock", mine)
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: want error %t, got %v", tt.name, tt.wantErr, err)
+		}
+
+		id := ""
+
+		if lock := s.lock("stack/.lock"); lock != nil {
+			id = lock.ID
+		}
+
+		if id != tt.wantID {
+			t.Errorf("%s: want lock held by %q, got %q", tt.name, tt.wantID, id)
+		}
+	}
+}
@@ -5,12 +5,248 @@ import (
 	"github.com/bernos/cfn-deploy/cfndeploy/commands"
 	"github.com/codegangsta/cli"
 	"os"
+	"time"
 )
 
 var (
 	version string
 )
 
+var (
+	stackNameFlag = cli.StringFlag{
+		Name:   "stackname,n",
+		Usage:  "Name of the stack to create",
+		EnvVar: "CFNDEPLOY_STACKNAME",
+	}
+
+	regionFlag = cli.StringFlag{
+		Name:   "region,r",
+		Usage:  "Region to deploy to",
+		EnvVar: "CFNDEPLOY_REGION",
+		Value:  "ap-southeast-2",
+	}
+
+	bucketFlag = cli.StringFlag{
+		Name:   "bucket,b",
+		Usage:  "Name of the S3 bucket to upload templates to",
+		EnvVar: "CFNDEPLOY_BUCKET",
+	}
+
+	bucketFolderFlag = cli.StringFlag{
+		Name:   "bucketfolder,k",
+		Usage:  "Optional bucket folder to upload templates to",
+		EnvVar: "CFNDEPLOY_BUCKET_FOLDER",
+	}
+
+	cfnRoleFlag = cli.StringFlag{
+		Name:   "cfn-role-arn",
+		Usage:  "Optional ARN of a service role that cloudformation uses for stack operations",
+		EnvVar: "CFNDEPLOY_CFN_ROLE_ARN",
+	}
+
+	outputFlag = cli.StringFlag{
+		Name:   "output,o",
+		Usage:  "Format of stack events. One of text, json or ndjson",
+		EnvVar: "CFNDEPLOY_OUTPUT",
+		Value:  "text",
+	}
+
+	configFlag = cli.StringFlag{
+		Name:   "config,c",
+		Usage:  "Optional JSON config file. Keys are flag names, values are used for flags not set on the command line",
+		EnvVar: "CFNDEPLOY_CONFIG",
+	}
+
+	// endpointFlags configure the connections to S3 and cloudformation
+	endpointFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "s3-endpoint",
+			Usage:  "Optional custom S3 endpoint, for example http://localhost:4566",
+			EnvVar: "CFNDEPLOY_S3_ENDPOINT",
+		},
+		cli.StringFlag{
+			Name:   "cfn-endpoint",
+			Usage:  "Optional custom cloudformation endpoint",
+			EnvVar: "CFNDEPLOY_CFN_ENDPOINT",
+		},
+		cli.BoolFlag{
+			Name:   "s3-path-style",
+			Usage:  "Use path style addressing for S3, rather than virtual hosted buckets",
+			EnvVar: "CFNDEPLOY_S3_PATH_STYLE",
+		},
+		cli.BoolFlag{
+			Name:   "insecure-skip-verify",
+			Usage:  "Do not verify TLS certificates. Only use this for local testing",
+			EnvVar: "CFNDEPLOY_INSECURE_SKIP_VERIFY",
+		},
+	}
+
+	// deployFlags configure the stack to deploy
+	deployFlags = []cli.Flag{
+		configFlag,
+		stackNameFlag,
+		regionFlag,
+		cli.StringFlag{
+			Name:   "main,m",
+			Usage:  "Name of the main cloudforamtion template",
+			EnvVar: "CFNDEPLOY_MAIN",
+			Value:  "Stack.json",
+		},
+		bucketFlag,
+		bucketFolderFlag,
+		cli.StringFlag{
+			Name:  "params,p",
+			Usage: "Stack parameters, in the format ParamOne=ValueOne,Param2=Value2",
+		},
+		cli.StringFlag{
+			Name:  "tags,t",
+			Usage: "Stack tag, in the format TagNameOne=TagValueOne,TagNameTwo=TagValueTwo",
+		},
+		cli.StringFlag{
+			Name:   "params-file",
+			Usage:  "Optional JSON file of stack parameters and tags, as written by pull. Values given with --params and --tags take precedence",
+			EnvVar: "CFNDEPLOY_PARAMS_FILE",
+		},
+		cfnRoleFlag,
+		cli.StringSliceFlag{
+			Name:  "notification-arn",
+			Usage: "ARN of an SNS topic to send stack events to. May be given more than once",
+		},
+		cli.BoolFlag{
+			Name:  "no-notification-arns",
+			Usage: "Stop sending stack events to the SNS topics currently set on the stack",
+		},
+		cli.Int64Flag{
+			Name:  "timeout-in-minutes",
+			Usage: "Optional time allowed for stack creation, in minutes",
+		},
+		cli.StringFlag{
+			Name:  "on-failure",
+			Usage: "Action to take if stack creation fails. One of ROLLBACK, DELETE or DO_NOTHING",
+		},
+		cli.BoolFlag{
+			Name:  "disable-rollback",
+			Usage: "Disable rollback of the stack if stack creation fails",
+		},
+		cli.StringFlag{
+			Name:  "termination-protection",
+			Usage: "Enable (true) or disable (false) termination protection. Left unchanged if not set",
+		},
+		cli.StringFlag{
+			Name:  "client-request-token",
+			Usage: "Optional token for the stack operation. Defaults to a token that is unique to each deployment. Pass the token of an earlier deployment only to retry that same deployment",
+		},
+		cli.StringFlag{
+			Name:  "stack-policy-file",
+			Usage: "Optional JSON stack policy file to apply to the stack",
+		},
+		cli.StringFlag{
+			Name:  "stack-policy-during-update-file",
+			Usage: "Optional JSON stack policy file that overrides the stack policy during this update only",
+		},
+		cli.StringSliceFlag{
+			Name:  "rollback-alarm-arn",
+			Usage: "ARN of a cloudwatch alarm that triggers a rollback if it goes into alarm. May be given more than once",
+		},
+		cli.DurationFlag{
+			Name:  "rollback-monitoring-period",
+			Usage: "Time to keep monitoring the rollback alarms after all resources are deployed, for example 10m",
+		},
+		cli.StringSliceFlag{
+			Name:  "protected-resource-type",
+			Usage: "Resource type that may not be removed or replaced. May be given more than once. Defaults to DB instances, DynamoDB tables, S3 buckets and EFS file systems",
+		},
+		cli.StringSliceFlag{
+			Name:  "allow-replace",
+			Usage: "Logical ID of a protected resource that may be removed or replaced. Use NestedStack.LogicalId for nested stacks. May be given more than once",
+		},
+		cli.BoolFlag{
+			Name:  "allow-destructive",
+			Usage: "Allow any protected resource to be removed or replaced",
+		},
+		cli.DurationFlag{
+			Name:  "wait-timeout",
+			Usage: "Maximum time to wait for an operation already in progress on the stack to finish",
+			Value: time.Minute * 30,
+		},
+		cli.BoolFlag{
+			Name:   "lock",
+			Usage:  "Hold a lock in the template bucket while deploying, so that the stack is not deployed concurrently",
+			EnvVar: "CFNDEPLOY_LOCK",
+		},
+		cli.StringFlag{
+			Name:   "lock-owner",
+			Usage:  "Name of the lock owner, shown to anyone waiting for the lock",
+			EnvVar: "CFNDEPLOY_LOCK_OWNER,USER",
+		},
+		cli.DurationFlag{
+			Name:  "lock-ttl",
+			Usage: "Time after which a lock is considered stale",
+			Value: time.Hour * 2,
+		},
+		cli.DurationFlag{
+			Name:  "lock-timeout",
+			Usage: "Maximum time to wait for a lock held by another deployment",
+		},
+	}
+
+	// templateFlags set the variables that templates ending in .tmpl are
+	// rendered with
+	templateFlags = []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "var",
+			Usage: "Template variable, in the format Name=Value. May be given more than once",
+		},
+		cli.StringFlag{
+			Name:   "vars-file",
+			Usage:  "Optional JSON file of template variables. Variables are also read from CFNDEPLOY_VAR_Name environment variables",
+			EnvVar: "CFNDEPLOY_VARS_FILE",
+		},
+	}
+
+	// stackFlags identify an existing stack
+	stackFlags = []cli.Flag{
+		configFlag,
+		stackNameFlag,
+		regionFlag,
+	}
+
+	// credentialFlags configure the credentials used for S3 and cloudformation
+	credentialFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "profile",
+			Usage:  "Optional named AWS profile to use",
+			EnvVar: "CFNDEPLOY_PROFILE",
+		},
+		cli.StringFlag{
+			Name:   "role-arn",
+			Usage:  "Optional ARN of a role to assume for stack operations, for example a role in another account",
+			EnvVar: "CFNDEPLOY_ROLE_ARN",
+		},
+		cli.StringFlag{
+			Name:   "external-id",
+			Usage:  "Optional external ID to use when assuming the role",
+			EnvVar: "CFNDEPLOY_EXTERNAL_ID",
+		},
+		cli.StringFlag{
+			Name:   "role-session-name",
+			Usage:  "Session name to use when assuming the role",
+			EnvVar: "CFNDEPLOY_ROLE_SESSION_NAME",
+			Value:  "cfndeploy",
+		},
+		cli.DurationFlag{
+			Name:   "role-duration",
+			Usage:  "Optional duration of the assumed role session, for example 1h",
+			EnvVar: "CFNDEPLOY_ROLE_DURATION",
+		},
+		cli.BoolFlag{
+			Name:   "bucket-source-credentials",
+			Usage:  "Access the template bucket with the source credentials, rather than the assumed role",
+			EnvVar: "CFNDEPLOY_BUCKET_SOURCE_CREDENTIALS",
+		},
+	}
+)
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "cfndeploy"
@@ -24,44 +260,220 @@ func main() {
 			Usage:       "Deploy templates",
 			Description: "Foobar",
 			Action:      commands.Deploy,
-			Flags: []cli.Flag{
+			Flags: joinFlags(deployFlags, []cli.Flag{
+				cli.BoolFlag{
+					Name:  "confirm",
+					Usage: "Show the changes and ask for confirmation before deploying. Requires an interactive terminal",
+				},
+				outputFlag,
 				cli.StringFlag{
-					Name:   "stackname,n",
-					Usage:  "Name of the stack to create",
-					EnvVar: "CFNDEPLOY_STACKNAME",
+					Name:  "timeline-file",
+					Usage: "Optional file to write the timeline of the deployment to",
 				},
 				cli.StringFlag{
-					Name:   "region,r",
-					Usage:  "Region to deploy to",
-					EnvVar: "CFNDEPLOY_REGION",
-					Value:  "ap-southeast-2",
+					Name:  "timeline-format",
+					Usage: "Format of the timeline file. Either json, or trace for a Chrome trace event file that can be opened in a trace viewer",
+					Value: "json",
 				},
 				cli.StringFlag{
-					Name:   "main,m",
-					Usage:  "Name of the main cloudforamtion template",
-					EnvVar: "CFNDEPLOY_MAIN",
-					Value:  "Stack.json",
+					Name:   "git-commit",
+					Usage:  "Git commit recorded in the deployment history. Defaults to the commit checked out in the template folder",
+					EnvVar: "CFNDEPLOY_GIT_COMMIT,GITHUB_SHA,CI_COMMIT_SHA,GIT_COMMIT",
 				},
+			}, templateFlags, endpointFlags, credentialFlags),
+		},
+		{
+			Name:        "render",
+			ArgsUsage:   "path/to/template/folder",
+			Usage:       "Render templates without deploying them",
+			Description: "Renders the templates ending in .tmpl and resolves include directives, then writes all files that would be uploaded to the output folder for inspection",
+			Action:      commands.Render,
+			Flags: joinFlags([]cli.Flag{
+				configFlag,
 				cli.StringFlag{
-					Name:   "bucket,b",
-					Usage:  "Name of the S3 bucket to upload templates to",
-					EnvVar: "CFNDEPLOY_BUCKET",
+					Name:  "out,o",
+					Usage: "Folder to write the rendered templates to",
+				},
+			}, templateFlags),
+		},
+		{
+			Name:        "plan",
+			ArgsUsage:   "[path/to/template/folder]",
+			Usage:       "Show how a deployment would change the stack settings",
+			Description: "Compares the stack settings given on the command line or in the config file with those of the live stack",
+			Action:      commands.Plan,
+			Flags:       joinFlags(deployFlags, endpointFlags, credentialFlags),
+		},
+		{
+			Name:  "policy",
+			Usage: "Show or set the stack policy of a stack",
+			Subcommands: []cli.Command{
+				{
+					Name:   "show",
+					Usage:  "Show the current stack policy",
+					Action: commands.PolicyShow,
+					Flags:  joinFlags(stackFlags, endpointFlags, credentialFlags),
+				},
+				{
+					Name:      "set",
+					ArgsUsage: "path/to/policy.json",
+					Usage:     "Set the stack policy",
+					Action:    commands.PolicySet,
+					Flags:     joinFlags(stackFlags, endpointFlags, credentialFlags),
+				},
+			},
+		},
+		{
+			Name:        "continue-update-rollback",
+			Usage:       "Continue rolling back a stack that failed to roll back",
+			Description: "Lists the resources that failed to roll back, then continues the rollback, optionally skipping some resources",
+			Action:      commands.ContinueUpdateRollback,
+			Flags: joinFlags(stackFlags, []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "skip-resource",
+					Usage: "Logical ID of a resource to skip. Use NestedStack.LogicalId for resources in nested stacks. May be given more than once",
+				},
+				cfnRoleFlag,
+				outputFlag,
+			}, endpointFlags, credentialFlags),
+		},
+		{
+			Name:        "delete",
+			Usage:       "Delete a stack",
+			Description: "Deletes a stack and waits for the deletion to complete, showing the events of the stack and its nested stacks",
+			Action:      commands.Delete,
+			Flags: joinFlags(stackFlags, []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "retain-resource",
+					Usage: "Logical ID of a resource that failed to delete, to keep rather than delete. May be given more than once",
+				},
+				cli.BoolFlag{
+					Name:  "yes,y",
+					Usage: "Delete the stack without asking for confirmation",
+				},
+				cfnRoleFlag,
+				outputFlag,
+			}, endpointFlags, credentialFlags),
+		},
+		{
+			Name:        "events",
+			Usage:       "Show the events of the most recent stack operation",
+			Description: "Shows the events of the most recent operation on a stack, including those of its nested stacks",
+			Action:      commands.Events,
+			Flags: joinFlags(stackFlags, []cli.Flag{
+				cli.BoolFlag{
+					Name:  "follow,f",
+					Usage: "Keep showing events until the operation in progress finishes",
+				},
+				cli.DurationFlag{
+					Name:  "wait-timeout",
+					Usage: "Maximum time to follow the operation",
+					Value: time.Minute * 30,
 				},
+				outputFlag,
+			}, endpointFlags, credentialFlags),
+		},
+		{
+			Name:        "drift",
+			Usage:       "Detect resources that were changed outside of cloudformation",
+			Description: "Detects drift of a stack and its nested stacks, and shows the expected and actual properties of each drifted resource. Exits with status 2 if drift is found",
+			Action:      commands.Drift,
+			Flags:       joinFlags(stackFlags, endpointFlags, credentialFlags),
+		},
+		{
+			Name:        "diff",
+			ArgsUsage:   "path/to/template/folder",
+			Usage:       "Show how the local templates differ from the deployed stack",
+			Description: "Compares the rendered local templates with the templates of the deployed stack and its nested stacks, by resource and property. Local artifacts are packaged, so that the properties that refer to them are compared with the S3 locations a deployment to the bucket would use. Parameters and tags are compared with the values that would be deployed",
+			Action:      commands.Diff,
+			Flags:       joinFlags(deployFlags, templateFlags, endpointFlags, credentialFlags),
+		},
+		{
+			Name:        "pull",
+			Usage:       "Export a deployed stack to a template folder",
+			Description: "Writes the templates of a stack and its nested stacks to a folder, rewriting the TemplateURL of each nested stack to use the TemplateBaseUrl parameter, so that the stack can be deployed with cfndeploy. The current parameters and tags are written to a params file",
+			Action:      commands.Pull,
+			Flags: joinFlags(stackFlags, []cli.Flag{
 				cli.StringFlag{
-					Name:   "bucketfolder,k",
-					Usage:  "Optional bucket folder to upload templates to",
-					EnvVar: "CFNDEPLOY_BUCKET_FOLDER",
+					Name:  "out,o",
+					Usage: "Folder to write the templates to",
 				},
 				cli.StringFlag{
-					Name:  "params,p",
-					Usage: "Stack parameters, in the format ParamOne=ValueOne,Param2=Value2",
+					Name:  "main,m",
+					Usage: "Name of the main template",
+					Value: "Stack.json",
 				},
 				cli.StringFlag{
-					Name:  "tags,t",
-					Usage: "Stack tag, in the format TagNameOne=TagValueOne,TagNameTwo=TagValueTwo",
+					Name:  "params-file",
+					Usage: "File to write the parameters and tags to. Defaults to STACKNAME.params.json. It must be outside the template folder, as all files in the folder are uploaded",
+				},
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "Overwrite existing templates and params file",
+				},
+			}, endpointFlags, credentialFlags),
+		},
+		{
+			Name:        "unlock",
+			Usage:       "Show or remove the deployment lock of a stack",
+			Description: "Shows who holds the deployment lock of a stack. With --force the lock is removed, for example when a deployment was killed without releasing it",
+			Action:      commands.Unlock,
+			Flags: joinFlags(stackFlags, []cli.Flag{
+				bucketFlag,
+				bucketFolderFlag,
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "Remove the lock, regardless of who holds it",
+				},
+			}, endpointFlags, credentialFlags),
+		},
+		{
+			Name:  "history",
+			Usage: "Show the recorded deployments of a stack",
+			Subcommands: []cli.Command{
+				{
+					Name:        "list",
+					Usage:       "List the recorded deployments, oldest first",
+					Description: "Lists the deployments recorded in the history index in the template bucket",
+					Action:      commands.HistoryList,
+					Flags:       joinFlags(stackFlags, []cli.Flag{bucketFlag, bucketFolderFlag}, endpointFlags, credentialFlags),
+				},
+				{
+					Name:        "show",
+					ArgsUsage:   "number|version",
+					Usage:       "Show a recorded deployment",
+					Description: "Shows a deployment, given by its number in the list or by its version. The most recent deployment of a version is shown",
+					Action:      commands.HistoryShow,
+					Flags:       joinFlags(stackFlags, []cli.Flag{bucketFlag, bucketFolderFlag}, endpointFlags, credentialFlags),
 				},
 			},
 		},
+		{
+			Name:        "prune",
+			Usage:       "Delete old template versions from S3",
+			Description: "Deletes all template versions of a stack from S3, except for the most recent, the recently uploaded and the version currently deployed",
+			Action:      commands.Prune,
+			Flags: joinFlags([]cli.Flag{
+				configFlag,
+				stackNameFlag,
+				regionFlag,
+				bucketFlag,
+				bucketFolderFlag,
+				cli.IntFlag{
+					Name:  "keep",
+					Usage: "Number of most recent versions to keep",
+					Value: 10,
+				},
+				cli.DurationFlag{
+					Name:  "min-age",
+					Usage: "Keep all versions younger than this, for example 168h",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Show the versions that would be deleted, without deleting them",
+				},
+			}, endpointFlags, credentialFlags),
+		},
 	}
 
 	err := app.Run(os.Args)
@@ -71,3 +483,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// joinFlags returns a single slice holding all of the given flags
+func joinFlags(groups ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+
+	for _, group := range groups {
+		flags = append(flags, group...)
+	}
+
+	return flags
+}
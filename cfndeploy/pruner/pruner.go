@@ -0,0 +1,265 @@
+package pruner
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// deleteBatchSize is the maximum number of keys accepted by a single
+	// DeleteObjects call
+	deleteBatchSize = 1000
+)
+
+// Pruner is an interface that can remove old template versions from S3
+type Pruner interface {
+	Prune(*PruneOptions) ([]*Version, error)
+}
+
+// PruneOptions holds options for pruning template versions
+type PruneOptions struct {
+	StackName    string
+	Bucket       string
+	BucketFolder string
+	Keep         int
+	MinAge       time.Duration
+	DryRun       bool
+}
+
+// Validate returns an error if the options are not valid
+func (o *PruneOptions) Validate() error {
+	if o.Keep < 0 {
+		return fmt.Errorf("Number of versions to keep must not be negative")
+	}
+	if o.MinAge < 0 {
+		return fmt.Errorf("Minimum age must not be negative")
+	}
+	return nil
+}
+
+// Version is a single template version uploaded to S3
+type Version struct {
+	Name         string
+	Prefix       string
+	LastModified time.Time
+	Keys         []string
+}
+
+// pruner implements the Pruner interface
+type pruner struct {
+	cfn cloudformationiface.CloudFormationAPI
+	s3  s3iface.S3API
+}
+
+// New creates a new Pruner instance
+func New(c cloudformationiface.CloudFormationAPI, s s3iface.S3API) Pruner {
+	return &pruner{
+		cfn: c,
+		s3:  s,
+	}
+}
+
+// Prune deletes all template versions of a stack that are not retained by the
+// given options, and returns the versions that were deleted. If DryRun is set
+// nothing is deleted, and the versions that would have been deleted are
+// returned.
+func (p *pruner) Prune(options *PruneOptions) ([]*Version, error) {
+	log.Printf("Finding live version of stack %s", options.StackName)
+	live, err := p.liveVersion(options.StackName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Listing template versions")
+	versions, err := p.listVersions(options.Bucket, calculateStackPrefix(options.StackName, options.BucketFolder))
+
+	if err != nil {
+		return nil, err
+	}
+
+	prunable := selectPrunable(versions, options.Keep, options.MinAge, live, time.Now())
+
+	if options.DryRun || len(prunable) == 0 {
+		return prunable, nil
+	}
+
+	var keys []string
+
+	for _, v := range prunable {
+		keys = append(keys, v.Keys...)
+	}
+
+	log.Printf("Deleting %d objects from %d versions", len(keys), len(prunable))
+
+	return prunable, p.deleteKeys(options.Bucket, keys)
+}
+
+// liveVersion returns the value of the Version parameter of the given stack,
+// or an empty string if the stack does not exist
+func (p *pruner) liveVersion(stackName string) (string, error) {
+	resp, err := p.cfn.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "ValidationError" && strings.Contains(aerr.Message(), "does not exist") {
+			return "", nil
+		}
+		return "", err
+	}
+
+	for _, stack := range resp.Stacks {
+		for _, param := range stack.Parameters {
+			if *param.ParameterKey == "Version" {
+				return *param.ParameterValue, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// listVersions lists all objects below prefix, and groups them by version.
+// Objects that live directly below prefix are not part of any version, and
+// are ignored.
+func (p *pruner) listVersions(bucket, prefix string) ([]*Version, error) {
+	versions := make(map[string]*Version)
+
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	err := p.s3.ListObjectsV2Pages(params, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			name, ok := versionName(*obj.Key, prefix)
+
+			if !ok {
+				continue
+			}
+
+			v, found := versions[name]
+
+			if !found {
+				v = &Version{
+					Name:   name,
+					Prefix: prefix + name + "/",
+				}
+				versions[name] = v
+			}
+
+			v.Keys = append(v.Keys, *obj.Key)
+
+			if obj.LastModified != nil && obj.LastModified.After(v.LastModified) {
+				v.LastModified = *obj.LastModified
+			}
+		}
+		return true
+	})
+
+	var result []*Version
+
+	for _, v := range versions {
+		result = append(result, v)
+	}
+
+	return result, err
+}
+
+// deleteKeys deletes the given keys from bucket, in batches
+func (p *pruner) deleteKeys(bucket string, keys []string) error {
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		end := start + deleteBatchSize
+
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var objects []*s3.ObjectIdentifier
+
+		for _, key := range keys[start:end] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		resp, err := p.s3.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if len(resp.Errors) > 0 {
+			e := resp.Errors[0]
+			return fmt.Errorf("Failed to delete %d objects. First error was %s: %s", len(resp.Errors), aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+	}
+
+	return nil
+}
+
+// selectPrunable returns the versions that are not retained. The keep most
+// recent versions, any version younger than minAge and the live version are
+// always retained.
+func selectPrunable(versions []*Version, keep int, minAge time.Duration, live string, now time.Time) []*Version {
+	sorted := make([]*Version, len(versions))
+	copy(sorted, versions)
+
+	sort.Sort(byLastModified(sorted))
+
+	var prunable []*Version
+
+	for i, v := range sorted {
+		if i < keep || now.Sub(v.LastModified) < minAge || v.Name == live {
+			continue
+		}
+		prunable = append(prunable, v)
+	}
+
+	return prunable
+}
+
+// versionName returns the version part of key, which is the first path
+// element after prefix
+func versionName(key, prefix string) (string, bool) {
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+
+	rest := key[len(prefix):]
+	i := strings.Index(rest, "/")
+
+	if i < 1 {
+		return "", false
+	}
+
+	return rest[:i], true
+}
+
+// calculateStackPrefix returns the bucket key prefix that holds all versions
+// of the given stack
+func calculateStackPrefix(stackName, bucketFolder string) string {
+	return path.Join(bucketFolder, stackName) + "/"
+}
+
+// byLastModified sorts versions from most to least recently modified
+type byLastModified []*Version
+
+func (s byLastModified) Len() int           { return len(s) }
+func (s byLastModified) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLastModified) Less(i, j int) bool { return s[i].LastModified.After(s[j].LastModified) }
@@ -0,0 +1,88 @@
+package pruner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelectPrunable(t *testing.T) {
+	now := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := time.Hour * 24
+
+	versions := []*Version{
+		{Name: "aaaaaaaa", LastModified: now.Add(-1 * day)},
+		{Name: "bbbbbbbb", LastModified: now.Add(-10 * day)},
+		{Name: "cccccccc", LastModified: now.Add(-5 * day)},
+		{Name: "dddddddd", LastModified: now.Add(-20 * day)},
+		{Name: "eeeeeeee", LastModified: now.Add(-2 * day)},
+	}
+
+	tests := []struct {
+		keep   int
+		minAge time.Duration
+		live   string
+		want   []string
+	}{
+		{0, 0, "", []string{"aaaaaaaa", "eeeeeeee", "cccccccc", "bbbbbbbb", "dddddddd"}},
+		{2, 0, "", []string{"cccccccc", "bbbbbbbb", "dddddddd"}},
+		{2, 0, "dddddddd", []string{"cccccccc", "bbbbbbbb"}},
+		{1, 7 * day, "", []string{"bbbbbbbb", "dddddddd"}},
+		{10, 0, "", nil},
+	}
+
+	for _, tt := range tests {
+		got := selectPrunable(versions, tt.keep, tt.minAge, tt.live, now)
+
+		if len(got) != len(tt.want) {
+			t.Errorf("Incorrect length. Want %d, got %d", len(tt.want), len(got))
+			continue
+		}
+
+		for i := range got {
+			if got[i].Name != tt.want[i] {
+				t.Errorf("Want %s, got %s", tt.want[i], got[i].Name)
+			}
+		}
+	}
+}
+
+func TestVersionName(t *testing.T) {
+	tests := []struct {
+		key    string
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{"foo/stack/1234abcd/templates/Stack.json", "foo/stack/", "1234abcd", true},
+		{"stack/1234abcd/templates/Stack.json", "stack/", "1234abcd", true},
+		{"foo/stack/.lock", "foo/stack/", "", false},
+		{"foo/other/1234abcd/templates/Stack.json", "foo/stack/", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := versionName(tt.key, tt.prefix)
+
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Want %s (%t), got %s (%t)", tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestCalculateStackPrefix(t *testing.T) {
+	tests := []struct {
+		bucketFolder string
+		stackName    string
+		want         string
+	}{
+		{"foo", "stack", "foo/stack/"},
+		{"", "stack", "stack/"},
+	}
+
+	for _, tt := range tests {
+		got := calculateStackPrefix(tt.stackName, tt.bucketFolder)
+
+		if got != tt.want {
+			t.Errorf("Want %s, got %s", tt.want, got)
+		}
+	}
+}
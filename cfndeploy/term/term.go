@@ -0,0 +1,34 @@
+package term
+
+import (
+	"os"
+	"strconv"
+)
+
+// Colour is an ANSI terminal colour
+type Colour int
+
+// Supported colours
+const (
+	Red    Colour = 31
+	Green  Colour = 32
+	Yellow Colour = 33
+	Blue   Colour = 34
+	Grey   Colour = 90
+)
+
+// IsTerminal returns true if f is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Colourize wraps s in the escape codes for colour c
+func Colourize(c Colour, s string) string {
+	return "\x1b[" + strconv.Itoa(int(c)) + "m" + s + "\x1b[0m"
+}
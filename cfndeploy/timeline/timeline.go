@@ -0,0 +1,341 @@
+package timeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported file formats
+const (
+	// JSONFormat writes the timeline as JSON
+	JSONFormat = "json"
+
+	// TraceFormat writes the timeline in the Chrome trace event format, which
+	// can be opened in a trace viewer such as chrome://tracing or Perfetto
+	TraceFormat = "trace"
+)
+
+// Span is a single operation on a resource
+type Span struct {
+	// Path is the nested stack path of the stack that holds the resource,
+	// which is empty for resources of the root stack
+	Path         string        `json:"path,omitempty"`
+	LogicalID    string        `json:"logicalId"`
+	ResourceType string        `json:"resourceType"`
+	Status       string        `json:"status"`
+	Start        time.Time     `json:"start"`
+	End          time.Time     `json:"end"`
+	Duration     time.Duration `json:"duration"`
+	Critical     bool          `json:"critical"`
+}
+
+// Name returns the logical ID of the resource, prefixed by its nested stack
+// path
+func (s *Span) Name() string {
+	if s.Path == "" {
+		return s.LogicalID
+	}
+	return s.Path + "." + s.LogicalID
+}
+
+// Timeline holds the operations on the resources of a stack and its nested
+// stacks during a single stack operation. Durations are written to JSON in
+// nanoseconds.
+type Timeline struct {
+	StackName string        `json:"stackName"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Duration  time.Duration `json:"duration"`
+	Spans     []*Span       `json:"spans"`
+
+	// CriticalPath holds the names of the resources on the likely critical
+	// path, which is the chain of operations that most likely determined the
+	// duration of the stack operation. It is estimated from the timing of
+	// the operations only, not from the dependencies in the templates.
+	CriticalPath []string `json:"criticalPath"`
+}
+
+// Recorder is an events.Formatter that keeps all events written to it, so
+// that a timeline can be built from them
+type Recorder struct {
+	mu     sync.Mutex
+	events []*events.Event
+}
+
+// Write records e
+func (r *Recorder) Write(e *events.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, e)
+	return nil
+}
+
+// Close does nothing
+func (r *Recorder) Close() error {
+	return nil
+}
+
+// Timeline builds the timeline of the recorded events
+func (r *Recorder) Timeline() *Timeline {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return Build(r.events)
+}
+
+// Build builds the timeline of the most recent operation on the root stack
+// from its events and those of its nested stacks. Events of earlier
+// operations are ignored.
+func Build(evts []*events.Event) *Timeline {
+	sorted := append([]*events.Event{}, evts...)
+	sort.Stable(byTimestamp(sorted))
+
+	t := &Timeline{}
+
+	// find the start of the most recent operation on the root stack
+	for _, e := range sorted {
+		if e.Path == "" && events.IsOperationStart(e.StackEvent) {
+			t.Start = aws.TimeValue(e.Timestamp)
+			t.StackName = aws.StringValue(e.StackName)
+		}
+	}
+
+	open := make(map[string]*Span)
+
+	for _, e := range sorted {
+		timestamp := aws.TimeValue(e.Timestamp)
+
+		if timestamp.Before(t.Start) {
+			continue
+		}
+
+		if timestamp.After(t.End) {
+			t.End = timestamp
+		}
+
+		if events.IsStackEvent(e.StackEvent) {
+			continue
+		}
+
+		status := aws.StringValue(e.ResourceStatus)
+		key := e.Path + "/" + aws.StringValue(e.LogicalResourceId)
+		span := open[key]
+
+		if span == nil {
+			span = &Span{
+				Path:         e.Path,
+				LogicalID:    aws.StringValue(e.LogicalResourceId),
+				ResourceType: aws.StringValue(e.ResourceType),
+				Start:        timestamp,
+			}
+			t.Spans = append(t.Spans, span)
+			open[key] = span
+		}
+
+		span.Status = status
+		span.End = timestamp
+		span.Duration = span.End.Sub(span.Start)
+
+		if !strings.HasSuffix(status, "_IN_PROGRESS") {
+			delete(open, key)
+		}
+	}
+
+	t.Duration = t.End.Sub(t.Start)
+	t.CriticalPath = criticalPath(t.Spans)
+
+	return t
+}
+
+// criticalPath marks and returns the chain of operations that most likely
+// determined the duration of the stack operation. This is a heuristic based
+// on timing alone, as the DependsOn and Ref dependencies between resources
+// are not known from events. Starting from the operation that finished last,
+// each step goes back to the operation that finished most recently before it
+// started, which is most likely the one it waited for, although it may just
+// have happened to finish first. Nested stacks are not part of the path
+// themselves, their resources are.
+func criticalPath(spans []*Span) []string {
+	var leaves []*Span
+
+	for _, s := range spans {
+		if s.ResourceType != "AWS::CloudFormation::Stack" {
+			leaves = append(leaves, s)
+		}
+	}
+
+	var (
+		path    []string
+		current *Span
+	)
+
+	for _, s := range leaves {
+		if current == nil || s.End.After(current.End) {
+			current = s
+		}
+	}
+
+	for current != nil {
+		current.Critical = true
+		path = append([]string{current.Name()}, path...)
+
+		var previous *Span
+
+		for _, s := range leaves {
+			if s.Critical || s.End.After(current.Start) {
+				continue
+			}
+
+			if previous == nil || s.End.After(previous.End) {
+				previous = s
+			}
+		}
+
+		current = previous
+	}
+
+	return path
+}
+
+// WriteSummary writes the timeline as a table, ordered by start time, with the
+// resources on the likely critical path marked
+func (t *Timeline) WriteSummary(w io.Writer) {
+	if len(t.Spans) == 0 {
+		fmt.Fprintf(w, "No resource operations recorded\n")
+		return
+	}
+
+	rows := [][]string{{"", "RESOURCE", "TYPE", "STATUS", "START", "DURATION"}}
+
+	for _, s := range t.Spans {
+		marker := ""
+
+		if s.Critical {
+			marker = "*"
+		}
+
+		rows = append(rows, []string{
+			marker,
+			s.Name(),
+			s.ResourceType,
+			s.Status,
+			"+" + s.Start.Sub(t.Start).String(),
+			s.Duration.String(),
+		})
+	}
+
+	widths := make([]int, len(rows[0]))
+
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	for _, row := range rows {
+		var cells []string
+
+		for i, cell := range row {
+			cells = append(cells, cell+strings.Repeat(" ", widths[i]-len(cell)))
+		}
+
+		fmt.Fprintf(w, "%s\n", strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+
+	fmt.Fprintf(w, "\nTotal %s. Resources marked * are on the likely critical path, estimated from timing rather than template dependencies\n", t.Duration)
+}
+
+// Write writes the timeline to w in the given format
+func (t *Timeline) Write(w io.Writer, format string) error {
+	switch format {
+	case JSONFormat, "":
+		return t.writeJSON(w)
+	case TraceFormat:
+		return t.writeTrace(w)
+	}
+
+	return fmt.Errorf("Unknown timeline format '%s'. Expected %s or %s", format, JSONFormat, TraceFormat)
+}
+
+func (t *Timeline) writeJSON(w io.Writer) error {
+	buf, err := json.MarshalIndent(t, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// traceEvent is an event in the Chrome trace event format
+type traceEvent struct {
+	Name     string            `json:"name"`
+	Category string            `json:"cat,omitempty"`
+	Phase    string            `json:"ph"`
+	Time     int64             `json:"ts"`
+	Duration int64             `json:"dur,omitempty"`
+	PID      int               `json:"pid"`
+	TID      int               `json:"tid"`
+	Args     map[string]string `json:"args,omitempty"`
+}
+
+// writeTrace writes the timeline in the Chrome trace event format. Each
+// resource is shown on its own row, with times relative to the start of the
+// stack operation.
+func (t *Timeline) writeTrace(w io.Writer) error {
+	trace := []*traceEvent{{
+		Name:  "process_name",
+		Phase: "M",
+		PID:   1,
+		Args:  map[string]string{"name": t.StackName},
+	}}
+
+	for i, s := range t.Spans {
+		trace = append(trace,
+			&traceEvent{
+				Name:  "thread_name",
+				Phase: "M",
+				PID:   1,
+				TID:   i + 1,
+				Args:  map[string]string{"name": s.Name()},
+			},
+			&traceEvent{
+				Name:     s.Name(),
+				Category: s.ResourceType,
+				Phase:    "X",
+				Time:     int64(s.Start.Sub(t.Start) / time.Microsecond),
+				Duration: int64(s.Duration / time.Microsecond),
+				PID:      1,
+				TID:      i + 1,
+				Args: map[string]string{
+					"status":   s.Status,
+					"critical": fmt.Sprint(s.Critical),
+				},
+			})
+	}
+
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"traceEvents":     trace,
+		"displayTimeUnit": "ms",
+	})
+}
+
+// byTimestamp sorts events from oldest to newest
+type byTimestamp []*events.Event
+
+func (a byTimestamp) Len() int      { return len(a) }
+func (a byTimestamp) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byTimestamp) Less(i, j int) bool {
+	return aws.TimeValue(a[i].Timestamp).Before(aws.TimeValue(a[j].Timestamp))
+}
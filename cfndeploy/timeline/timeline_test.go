@@ -0,0 +1,104 @@
+package timeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/bernos/cfn-deploy/cfndeploy/events"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testEvent(path, stackID, logicalID, physicalID, resourceType, status string, second int) *events.Event {
+	return &events.Event{
+		StackEvent: &cloudformation.StackEvent{
+			StackName:          aws.String(stackID),
+			StackId:            aws.String(stackID),
+			LogicalResourceId:  aws.String(logicalID),
+			PhysicalResourceId: aws.String(physicalID),
+			ResourceType:       aws.String(resourceType),
+			ResourceStatus:     aws.String(status),
+			Timestamp:          aws.Time(time.Date(2016, 5, 1, 10, 0, second, 0, time.UTC)),
+		},
+		Path: path,
+	}
+}
+
+func testEvents() []*events.Event {
+	return []*events.Event{
+		// previous operation
+		testEvent("", "root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 0),
+		testEvent("", "root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 1),
+
+		testEvent("", "root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 10),
+		testEvent("", "root", "Role", "role", "AWS::IAM::Role", "UPDATE_IN_PROGRESS", 11),
+		testEvent("", "root", "Queue", "queue", "AWS::SQS::Queue", "UPDATE_IN_PROGRESS", 11),
+		testEvent("", "root", "Queue", "queue", "AWS::SQS::Queue", "UPDATE_COMPLETE", 13),
+		testEvent("", "root", "Role", "role", "AWS::IAM::Role", "UPDATE_COMPLETE", 20),
+		testEvent("", "root", "Web", "web", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 21),
+		testEvent("Web", "web", "web", "web", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", 21),
+		testEvent("Web", "web", "Function", "function", "AWS::Lambda::Function", "UPDATE_IN_PROGRESS", 22),
+		testEvent("Web", "web", "Function", "function", "AWS::Lambda::Function", "UPDATE_COMPLETE", 40),
+		testEvent("Web", "web", "web", "web", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 41),
+		testEvent("", "root", "Web", "web", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 42),
+		testEvent("", "root", "root", "root", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE", 43),
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tl := Build(testEvents())
+
+	if tl.Duration != 33*time.Second {
+		t.Errorf("Want 33s, got %s", tl.Duration)
+	}
+
+	durations := map[string]time.Duration{}
+
+	for _, s := range tl.Spans {
+		durations[s.Name()] = s.Duration
+	}
+
+	wantDurations := map[string]time.Duration{
+		"Role":         9 * time.Second,
+		"Queue":        2 * time.Second,
+		"Web":          21 * time.Second,
+		"Web.Function": 18 * time.Second,
+	}
+
+	if !reflect.DeepEqual(durations, wantDurations) {
+		t.Errorf("Want %v, got %v", wantDurations, durations)
+	}
+
+	if want := []string{"Role", "Web.Function"}; !reflect.DeepEqual(tl.CriticalPath, want) {
+		t.Errorf("Want %v, got %v", want, tl.CriticalPath)
+	}
+}
+
+func TestWriteTrace(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := Build(testEvents()).Write(&buf, TraceFormat); err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	var trace struct {
+		TraceEvents []*traceEvent `json:"traceEvents"`
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatalf("Error: %s", err.Error())
+	}
+
+	// a process name, then a thread name and a span for each resource
+	if len(trace.TraceEvents) != 9 {
+		t.Fatalf("Want 9 trace events, got %d", len(trace.TraceEvents))
+	}
+
+	function := trace.TraceEvents[8]
+
+	if function.Name != "Web.Function" || function.Time != 12000000 || function.Duration != 18000000 {
+		t.Errorf("Want Web.Function at 12000000 for 18000000, got %s at %d for %d", function.Name, function.Time, function.Duration)
+	}
+}
@@ -0,0 +1,15 @@
+package uploader
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// IsConditionFailed returns true if err means that a conditional write did
+// not succeed because its condition was not met, or because it conflicted
+// with another conditional write
+func IsConditionFailed(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == "PreconditionFailed" || aerr.Code() == "ConditionalRequestConflict"
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package uploader
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"testing"
+)
+
+func TestIsConditionFailed(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{awserr.New("PreconditionFailed", "changed", nil), true},
+		{awserr.New("ConditionalRequestConflict", "conflict", nil), true},
+		{awserr.New("AccessDenied", "denied", nil), false},
+		{errors.New("PreconditionFailed"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsConditionFailed(tt.err); got != tt.want {
+			t.Errorf("Want %t, got %t for %v", tt.want, got, tt.err)
+		}
+	}
+}
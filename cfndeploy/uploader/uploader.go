@@ -65,8 +65,21 @@ func New(s3 s3manageriface.UploaderAPI) Uploader {
 	}
 }
 
+// NewWithEndpoint builds a new S3 uploader for an S3 compatible service hosted
+// at a custom endpoint. Upload result URLs are built from the endpoint rather
+// than taken from the upload response.
+func NewWithEndpoint(s3 s3manageriface.UploaderAPI, endpoint string, pathStyle bool) Uploader {
+	return &uploader{
+		s3:        s3,
+		endpoint:  endpoint,
+		pathStyle: pathStyle,
+	}
+}
+
 type uploader struct {
-	s3 s3manageriface.UploaderAPI
+	s3        s3manageriface.UploaderAPI
+	endpoint  string
+	pathStyle bool
 }
 
 func (u *uploader) UploadFiles(files []string, basePath, bucket, keyPrefix string) (UploadResults, error) {
@@ -155,6 +168,8 @@ func (u *uploader) UploadFile(file, bucket, key string) *UploadResult {
 
 	if err != nil {
 		result.Error = err
+	} else if u.endpoint != "" {
+		result.URL, result.Error = objectURL(u.endpoint, u.pathStyle, bucket, key)
 	} else {
 		result.URL = resp.Location
 	}
@@ -0,0 +1,36 @@
+package uploader
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// objectURL builds the URL of the object stored at key in bucket, for an S3
+// compatible service hosted at endpoint. If pathStyle is true the bucket name
+// is part of the URL path, otherwise it is part of the host name.
+func objectURL(endpoint string, pathStyle bool, bucket, key string) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+
+	if err != nil {
+		return "", err
+	}
+
+	if u.Host == "" {
+		return "", fmt.Errorf("Invalid S3 endpoint %s", endpoint)
+	}
+
+	if pathStyle {
+		u.Path = path.Join("/", u.Path, bucket, key)
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+
+	return u.String(), nil
+}
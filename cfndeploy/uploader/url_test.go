@@ -0,0 +1,31 @@
+package uploader
+
+import (
+	"testing"
+)
+
+func TestObjectURL(t *testing.T) {
+	tests := []struct {
+		endpoint  string
+		pathStyle bool
+		key       string
+		want      string
+	}{
+		{"http://localhost:4566", true, "foo/stack/123/templates/Stack.json", "http://localhost:4566/bucket/foo/stack/123/templates/Stack.json"},
+		{"http://localhost:4566", false, "foo/Stack.json", "http://bucket.localhost:4566/foo/Stack.json"},
+		{"s3.internal.example.com", true, "/Stack.json", "https://s3.internal.example.com/bucket/Stack.json"},
+		{"https://minio.example.com/s3", true, "Stack.json", "https://minio.example.com/s3/bucket/Stack.json"},
+	}
+
+	for _, tt := range tests {
+		got, err := objectURL(tt.endpoint, tt.pathStyle, "bucket", tt.key)
+
+		if err != nil {
+			t.Errorf("Error: %s", err.Error())
+		}
+
+		if got != tt.want {
+			t.Errorf("Want %s, got %s", tt.want, got)
+		}
+	}
+}